@@ -0,0 +1,69 @@
+package main
+
+import "fmt"
+
+// 生成するコードの関数の呼び出し規約.
+type ABI struct {
+	// 整数の引数を渡すレジスタ
+	// 収まらない引数はスタックに並べて渡す
+	ArgRegs []string
+
+	// 複数の戻り値を返すレジスタ
+	// 空の場合、呼び出し元が戻り値を書き込む領域を用意し、
+	// そのアドレスを最初の引数として渡す
+	ResultRegs []string
+
+	// 引数の受け渡しに使わない作業用のレジスタ
+	Scratch [2]string
+
+	// 呼び出し元がレジスタで渡す引数の退避領域をスタックに確保する
+	Spill bool
+
+	// 可変長引数の関数のために、呼び出しの前にalを0にする
+	ClearAL bool
+}
+
+// GoのABIInternalで整数の引数と戻り値に使うレジスタ.
+var goIntRegs = []string{"rax", "rbx", "rcx", "rdi", "rsi", "r8", "r9", "r10", "r11"}
+
+var (
+	// System V AMD64 ABI
+	abiC = &ABI{
+		ArgRegs: []string{"rdi", "rsi", "rdx", "rcx", "r8", "r9"},
+		Scratch: [2]string{"r11", "r10"},
+		ClearAL: true,
+	}
+
+	// GoのABIInternal
+	// r14はgを指すので使わない
+	// スタックの伸長には対応していない.
+	abiInternal = &ABI{
+		ArgRegs:    goIntRegs,
+		ResultRegs: goIntRegs,
+		Scratch:    [2]string{"r12", "r13"},
+		Spill:      true,
+	}
+)
+
+// -abiで指定できる呼び出し規約.
+var abis = map[string]*ABI{
+	"c":        abiC,
+	"internal": abiInternal,
+}
+
+// 生成するコードの呼び出し規約.
+var abi = abiC
+
+func lookupABI(name string) (*ABI, error) {
+	a, ok := abis[name]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", name, ErrUnknownABI)
+	}
+
+	return a, nil
+}
+
+// 複数の戻り値の書き込み先を隠れた引数として渡すのであれば真を返す.
+func (a *ABI) HiddenResult() bool {
+	return len(a.ResultRegs) == 0
+}
@@ -0,0 +1,1914 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// 関数名と関数定義の対応.
+var funcDefs map[string]*Node
+
+// 型検査中の関数定義.
+var currentFunc *Node
+
+// パッケージレベルの変数を初期化する関数
+// 初期値が定数でない変数を、依存関係に従った順に初期化する.
+var initFunc *Node
+
+// 型検査を始めたパッケージレベルの宣言とローカルな定数宣言
+// 検査を終えたものは真になる.
+var checkedDecls map[*Node]bool
+
+// 構文木に型を付け、型の誤りを報告する.
+func check(nodes *Node) error {
+	funcDefs = make(map[string]*Node)
+	checkedDecls = make(map[*Node]bool)
+	initFunc = NewNodeFuncDef([]rune("went.init"), nil, typeVoid, nil, nil, nil)
+
+	for node := nodes; node != nil; node = node.Next {
+		if node.Kind != NDFuncDef {
+			continue
+		}
+
+		name := string(node.Name)
+
+		if _, ok := funcDefs[name]; ok {
+			if err := typeErr(node, "関数が再定義されています: %s", name); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if _, ok := globalVars[name]; ok {
+			if err := typeErr(node, "%sは既に宣言されています", name); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		funcDefs[name] = node
+	}
+
+	if err := layoutPendingTypes(); err != nil {
+		return err
+	}
+
+	for node := nodes; node != nil; node = node.Next {
+		var err error
+
+		if node.Kind == NDFuncDef {
+			err = checkFunction(node)
+		} else {
+			err = checkDecl(node)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := errorList.Err(); err != nil {
+		return err
+	}
+
+	if err := initOrder(nodes); err != nil {
+		return err
+	}
+
+	return errorList.Err()
+}
+
+// 長さを式で書いた配列型の長さを求め、保留していた型の大きさを決める
+// 型は作られた順に並んでいるので、要素の型の大きさは先に決まる
+// 型宣言で複製された型は、元の型と長さの式を共有する.
+func layoutPendingTypes() error {
+	fn := currentFunc
+	currentFunc = initFunc
+
+	checked := make(map[*Node]bool)
+
+	for _, ty := range pendingTypes {
+		if n := ty.LenExpr; n != nil {
+			if !checked[n] {
+				checked[n] = true
+
+				if err := checkArrayLen(n); err != nil {
+					return err
+				}
+			}
+
+			// 誤りがあった長さは0とみなす
+			if n.Type != nil {
+				ty.Len = n.Val
+			}
+
+			ty.LenExpr = nil
+		}
+
+		ty.layout()
+	}
+
+	currentFunc = fn
+	pendingTypes = nil
+
+	return nil
+}
+
+// 配列の長さの式を検査する
+// 長さはint型で表せる負でない定数でなければならない.
+func checkArrayLen(node *Node) error {
+	// ローカル変数の型は、この時点ではまだ決まっていないことがある
+	var local bool
+
+	walk(node, func(n *Node) {
+		local = local || (n.Kind == NDLocalV && n.Var.Decl == nil)
+	})
+
+	if local {
+		return typeErr(node, "配列の長さが定数ではありません")
+	}
+
+	if err := checkValue(node); err != nil {
+		return err
+	}
+
+	ty := node.Type
+	if ty == nil {
+		return nil
+	}
+
+	node.Type = nil
+
+	switch {
+	case !ty.IsInteger():
+		return typeErr(node, "配列の長さが整数ではありません: %s", defaultType(ty))
+	case node.Kind != NDNum:
+		return typeErr(node, "配列の長さが定数ではありません")
+	case node.Const.Sign() < 0:
+		return typeErr(node, "配列の長さが負です: %s", node.Const)
+	case !representable(node.Const, typeInt):
+		return typeErr(node, "配列の長さが大きすぎます")
+	}
+
+	node.Type = ty
+
+	return nil
+}
+
+// パッケージレベルの変数や定数の宣言と、ローカルな定数宣言を検査する
+// 参照された時点で検査していなければ、その場で検査する
+// 初期値の式で使う一時変数は、初期化を行う関数に置く.
+func checkDecl(node *Node) error {
+	if done, ok := checkedDecls[node]; ok {
+		if !done {
+			return typeErr(node, "初期化が循環しています: %s", declName(node))
+		}
+
+		return nil
+	}
+
+	checkedDecls[node] = false
+
+	fn := currentFunc
+	currentFunc = initFunc
+
+	var err error
+
+	if node.Kind == NDConstDecl {
+		err = checkConstDecl(node)
+	} else {
+		err = checkVarDecl(node)
+	}
+
+	currentFunc = fn
+	checkedDecls[node] = true
+
+	return err
+}
+
+// エラーの報告に使う、宣言された最初の名前.
+func declName(node *Node) string {
+	for l := node.Left; l != nil; l = l.Next {
+		if l.Kind != NDBlank {
+			return string(l.Var.Name)
+		}
+	}
+
+	return "_"
+}
+
+// 定数宣言を検査し、各定数の値を求める
+// 型が省略されていれば、値の型を定数の型とする.
+func checkConstDecl(node *Node) error {
+	if nl, nr := listLen(node.Left), listLen(node.Right); nl != nr {
+		return typeErr(node, "定数の名前と値の数が一致しません: %d と %d", nl, nr)
+	}
+
+	for l, r := node.Left, node.Right; l != nil; l, r = l.Next, r.Next {
+		if err := checkValue(r); err != nil {
+			return err
+		}
+
+		if r.Type == nil {
+			continue
+		}
+
+		c, ok := constant(r)
+		if !ok {
+			return typeErr(r, "定数式ではありません")
+		}
+
+		if l.Kind == NDBlank {
+			continue
+		}
+
+		if err := checkAssignable(r, l.Var.Type); err != nil {
+			return err
+		}
+
+		l.Var.Type = c.Type
+		l.Var.Const = c
+	}
+
+	return nil
+}
+
+// 定数式の値を表すリテラルを返す
+// 整数や真偽値の定数式と、文字列定数の連結は、型検査で1つのリテラルに畳み込まれている.
+func constant(node *Node) (*Node, bool) {
+	return node, node.Kind == NDNum || node.Kind == NDStr
+}
+
+// 型のない定数が持てる値のビット数.
+const maxConstBits = 512
+
+// 定数vをty型で表せれば真を返す
+// 型のない定数は、扱える精度に収まっていればよい.
+func representable(v *big.Int, ty *Type) bool {
+	switch {
+	case ty.IsUntyped():
+		return v.BitLen() <= maxConstBits
+	case ty.Kind == TYBool:
+		return true
+	case ty.Kind == TYByte:
+		return v.Sign() >= 0 && v.BitLen() <= 8*ty.Size
+	}
+
+	// 負の数-xは、x-1が表せれば表せる
+	if v.Sign() < 0 {
+		return new(big.Int).Not(v).BitLen() < 8*ty.Size
+	}
+
+	return v.BitLen() < 8*ty.Size
+}
+
+// ノードを値がv、型がtyの定数にする
+// 値をty型で表せなければ誤りにし、型はnilにする.
+func setConst(node *Node, v *big.Int, ty *Type) error {
+	if !representable(v, ty) {
+		node.Type = nil
+
+		if ty.IsUntyped() {
+			return typeErr(node, "定数がオーバーフローしました")
+		}
+
+		return typeErr(node, "定数%sは%s型で表せません", v, ty)
+	}
+
+	node.Kind = NDNum
+	node.Left, node.Right = nil, nil
+	node.Val = int(v.Int64())
+	node.Const = v
+	node.Type = ty
+
+	return nil
+}
+
+// 型のない定数をty型の値にする.
+func convertUntyped(node *Node, ty *Type) error {
+	if !ty.IsInteger() {
+		return typeErr(node, "%s型の値を%s型として使えません", defaultType(node.Type), ty)
+	}
+
+	return setConst(node, node.Const, ty)
+}
+
+// 型のないnilをty型のnilにする
+// スライスのnilは、要素を指さない長さ0のスライスを置く一時変数を用意する.
+func convertNil(node *Node, ty *Type) error {
+	if !ty.IsNilable() {
+		return typeErr(node, "nilを%s型として使えません", ty)
+	}
+
+	node.Type = ty
+
+	if ty.IsAggregate() {
+		node.Var = newLocalVar(ty)
+	}
+
+	return nil
+}
+
+// 型が文脈から決まらない式で、型のない定数を既定の型の値にする
+// 型のないnilには既定の型がない.
+func convertDefault(node *Node) error {
+	if node.Type != nil && node.Type.Kind == TYNil {
+		node.Type = nil
+
+		return typeErr(node, "型のないnilは使えません")
+	}
+
+	if node.Type == nil || !node.Type.IsUntyped() {
+		return nil
+	}
+
+	return convertUntyped(node, defaultType(node.Type))
+}
+
+// 定数どうしの演算を、結果の値を持つ1つの定数に畳み込む
+// 被演算子が定数でなければ何もしない.
+func foldConst(node *Node) error {
+	x, y := node.Left, node.Right
+
+	// 文字列定数の連結は、内容を連結した文字列リテラルにする
+	if node.Kind == NDAdd && x.Kind == NDStr && y.Kind == NDStr {
+		tok := *x.Tok
+		tok.Contents = append(append([]byte{}, x.Tok.Contents...), y.Tok.Contents...)
+
+		node.Kind = NDStr
+		node.Left, node.Right = nil, nil
+		node.Tok = &tok
+
+		return nil
+	}
+	if node.Type == nil || x.Kind != NDNum || (y != nil && y.Kind != NDNum) {
+		return nil
+	}
+
+	v := new(big.Int)
+
+	switch node.Kind {
+	case NDAdd:
+		v.Add(x.Const, y.Const)
+	case NDSub:
+		v.Sub(x.Const, y.Const)
+	case NDMul:
+		v.Mul(x.Const, y.Const)
+	case NDDiv:
+		v.Quo(x.Const, y.Const)
+	case NDMod:
+		v.Rem(x.Const, y.Const)
+	case NDBitAnd:
+		v.And(x.Const, y.Const)
+	case NDBitOr:
+		v.Or(x.Const, y.Const)
+	case NDBitXor:
+		v.Xor(x.Const, y.Const)
+	case NDAndNot:
+		v.AndNot(x.Const, y.Const)
+	case NDShl:
+		// 結果の精度を超えるシフトは計算する前に誤りにする
+		if x.Const.Sign() != 0 && y.Const.Int64() > maxConstBits {
+			node.Type = nil
+
+			return typeErr(node, "定数がオーバーフローしました")
+		}
+
+		v.Lsh(x.Const, uint(y.Const.Int64()))
+	case NDShr:
+		v.Rsh(x.Const, uint(y.Const.Int64()))
+	case NDNot:
+		v.SetInt64(boolValue(x.Const.Sign() == 0))
+	case NDBitNot:
+		// 符号なしの型では、型の大きさの範囲でビットを反転する
+		if node.Type.Kind == TYByte {
+			mask := new(big.Int).Lsh(big.NewInt(1), uint(8*node.Type.Size))
+			v.Xor(x.Const, mask.Sub(mask, big.NewInt(1)))
+		} else {
+			v.Not(x.Const)
+		}
+	case NDEq:
+		v.SetInt64(boolValue(x.Const.Cmp(y.Const) == 0))
+	case NDNe:
+		v.SetInt64(boolValue(x.Const.Cmp(y.Const) != 0))
+	case NDLt:
+		v.SetInt64(boolValue(x.Const.Cmp(y.Const) < 0))
+	case NDLe:
+		v.SetInt64(boolValue(x.Const.Cmp(y.Const) <= 0))
+	case NDLogAnd:
+		v.SetInt64(boolValue(x.Const.Sign() != 0 && y.Const.Sign() != 0))
+	case NDLogOr:
+		v.SetInt64(boolValue(x.Const.Sign() != 0 || y.Const.Sign() != 0))
+	default:
+		return nil
+	}
+
+	return setConst(node, v, node.Type)
+}
+
+// 真偽値を整数で表す.
+func boolValue(b bool) int64 {
+	if b {
+		return 1
+	}
+
+	return 0
+}
+
+// パッケージレベルの変数の宣言で、初期値がないか、すべての初期値が定数であれば真を返す
+// そのような変数は実行時に初期化せず、値をデータとして置く.
+func staticInit(node *Node) bool {
+	if node.Right == nil {
+		return true
+	}
+
+	if listLen(node.Left) != listLen(node.Right) {
+		return false
+	}
+
+	for r := node.Right; r != nil; r = r.Next {
+		if !staticValue(r) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// 値をデータとして置ける式であれば真を返す
+// 定数とnil、要素がすべてそのような式である配列や構造体の複合リテラルが当てはまる.
+func staticValue(node *Node) bool {
+	switch node.Kind {
+	case NDNum, NDStr, NDNil:
+		return true
+	case NDCopy, NDKeyVal:
+		return staticValue(node.Left)
+	case NDCompLit:
+		if node.Type.Kind == TYSlice {
+			return false
+		}
+
+		for elem := node.Args; elem != nil; elem = elem.Next {
+			if !staticValue(elem) {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	return false
+}
+
+// パッケージレベルの変数を初期化する順序を決め、初期化を行う関数の本体を作る
+// 初期化されていない変数に依存しない宣言のうち、最も先に宣言されたものから順に初期化する.
+func initOrder(nodes *Node) error {
+	var pending []*Node
+
+	deps := make(map[*Node]map[*Node]bool)
+
+	for node := nodes; node != nil; node = node.Next {
+		if node.Kind == NDVarDecl && !staticInit(node) {
+			pending = append(pending, node)
+			deps[node] = make(map[*Node]bool)
+			initDeps(node.Right, deps[node], make(map[*Node]bool))
+		}
+	}
+
+	head := NewNode(NDUndefined, nil, nil, nil)
+	cur := head
+
+	for len(pending) > 0 {
+		next := -1
+
+		for i, decl := range pending {
+			ready := true
+
+			for _, other := range pending {
+				if deps[decl][other] {
+					ready = false
+
+					break
+				}
+			}
+
+			if ready {
+				next = i
+
+				break
+			}
+		}
+
+		if next < 0 {
+			return typeErr(pending[0], "初期化が循環しています: %s", declName(pending[0]))
+		}
+
+		decl := pending[next]
+		pending = append(pending[:next], pending[next+1:]...)
+
+		cur.Next = NewNode(NDAssign, decl.Left, decl.Right, decl.Tok)
+		cur = cur.Next
+	}
+
+	initFunc.Body = head.Next
+
+	return nil
+}
+
+// 式の評価が依存するパッケージレベルの宣言をdepsに加える
+// 呼び出す関数の本体で参照するものも含める
+// funcsには既にたどった関数を記録する.
+func initDeps(node *Node, deps map[*Node]bool, funcs map[*Node]bool) {
+	walk(node, func(n *Node) {
+		switch n.Kind {
+		case NDGlobalV:
+			deps[n.Var.Decl] = true
+		case NDFuncCall:
+			if fn := funcDefs[string(n.Name)]; fn != nil && !funcs[fn] {
+				funcs[fn] = true
+				initDeps(fn.Body, deps, funcs)
+			}
+		}
+	})
+}
+
+// 型の誤りを記録する.
+func typeErr(node *Node, format string, a ...interface{}) error {
+	return errorList.Add(node.Tok.Err(fmt.Sprintf(format, a...)))
+}
+
+func checkFunction(node *Node) error {
+	currentFunc = node
+
+	for body := node.Body; body != nil; body = body.Next {
+		if err := checkStmt(body); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func checkStmt(node *Node) error {
+	switch node.Kind {
+	case NDReturn:
+		ret := currentFunc.Type
+
+		if node.Left == nil {
+			if ret != typeVoid {
+				return typeErr(node, "戻り値がありません")
+			}
+
+			return nil
+		}
+
+		want := []*Type{ret}
+		if ret.Kind == TYTuple {
+			want = nil
+
+			for _, f := range ret.Fields {
+				want = append(want, f.Type)
+			}
+		}
+
+		types, err := checkValues(node.Left, len(want))
+		if err != nil {
+			return err
+		}
+
+		if ret == typeVoid {
+			return typeErr(node.Left, "戻り値を返せない関数です")
+		}
+
+		if len(types) > len(want) {
+			return typeErr(node, "戻り値が多すぎます")
+		}
+
+		if len(types) < len(want) {
+			return typeErr(node, "戻り値が足りません")
+		}
+
+		for i, r := 0, node.Left; i < len(want); i++ {
+			if err := checkAssignableType(r, types[i], want[i]); err != nil {
+				return err
+			}
+
+			if r.Next != nil {
+				r = r.Next
+			}
+		}
+
+		return nil
+	case NDIf:
+		if node.Init != nil {
+			if err := checkStmt(node.Init); err != nil {
+				return err
+			}
+		}
+
+		if err := checkCond(node.Cond); err != nil {
+			return err
+		}
+
+		if err := checkStmt(node.Then); err != nil {
+			return err
+		}
+
+		if node.Else != nil {
+			return checkStmt(node.Else)
+		}
+
+		return nil
+	case NDFor:
+		if node.Init != nil {
+			if err := checkStmt(node.Init); err != nil {
+				return err
+			}
+		}
+
+		if node.Cond != nil {
+			if err := checkCond(node.Cond); err != nil {
+				return err
+			}
+		}
+
+		if node.Inc != nil {
+			if err := checkStmt(node.Inc); err != nil {
+				return err
+			}
+		}
+
+		return checkStmt(node.Then)
+	case NDSwitch:
+		return checkSwitch(node)
+	case NDAssign:
+		return checkAssign(node)
+	case NDVarDecl:
+		return checkVarDecl(node)
+	case NDConstDecl:
+		return checkDecl(node)
+	case NDBreak, NDContinue:
+		return nil
+	case NDFallthrough:
+		// case節の最後にあるものはcheckSwitchで扱う
+		return typeErr(node, "fallthroughはここでは使えません")
+	case NDBlock:
+		for cur := node.Body; cur != nil; cur = cur.Next {
+			if err := checkStmt(cur); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	return checkExpr(node)
+}
+
+// switch文を検査する
+// タグのないswitch文では、case節の式はbool型の条件式になる
+// タグのあるswitch文では、case節ごとにタグとの比較式をCondに並べる.
+func checkSwitch(node *Node) error {
+	if node.Init != nil {
+		if err := checkStmt(node.Init); err != nil {
+			return err
+		}
+	}
+
+	tag := node.Cond
+
+	if tag != nil {
+		if err := checkValue(tag); err != nil {
+			return err
+		}
+
+		if err := convertDefault(tag); err != nil {
+			return err
+		}
+
+		node.Var.Type = tag.Type
+	}
+
+	// 既に現れた定数のcaseの値
+	seen := make(map[int]bool)
+
+	for clause := node.Body; clause != nil; clause = clause.Next {
+		if tag == nil {
+			clause.Cond = clause.Args
+		}
+
+		cur := &Node{}
+
+		for e := clause.Args; e != nil; e = e.Next {
+			if tag == nil {
+				if err := checkCond(e); err != nil {
+					return err
+				}
+
+				continue
+			}
+
+			cond := NewNode(NDEq, NewNodeLocalValue(node.Var, e.Tok), e, e.Tok)
+
+			if err := checkCaseExpr(cond, seen); err != nil {
+				return err
+			}
+
+			cur.Next = cond
+			cur = cond
+
+			if clause.Cond == nil {
+				clause.Cond = cond
+			}
+		}
+
+		for body := clause.Body; body != nil; body = body.Next {
+			// fallthroughは最後以外のcase節の最後の文にだけ書ける
+			if body.Kind == NDFallthrough && body.Next == nil {
+				if clause.Next == nil {
+					return typeErr(body, "最後の節ではfallthroughを使えません")
+				}
+
+				continue
+			}
+
+			if err := checkStmt(body); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// タグとcase節の式の比較を検査する.
+func checkCaseExpr(cond *Node, seen map[int]bool) error {
+	if err := checkExpr(cond); err != nil {
+		return err
+	}
+
+	node := cond.Right
+
+	if cond.Type == nil || node.Kind != NDNum {
+		return nil
+	}
+
+	if seen[node.Val] {
+		if node.Type.IsInteger() {
+			return typeErr(node, "caseの値が重複しています: %d", node.Val)
+		}
+
+		return typeErr(node, "caseの値が重複しています: %s", string(node.Tok.Str))
+	}
+
+	seen[node.Val] = true
+
+	return nil
+}
+
+// 代入文と、初期値のある変数宣言を検査する
+// 左辺が_の場合、右辺の値は捨てられる
+// 変数宣言で型が省略されている場合は、右辺の値の型を変数の型とする.
+func checkAssign(node *Node) error {
+	nl := listLen(node.Left)
+
+	types, err := checkValues(node.Right, nl)
+	if err != nil {
+		return err
+	}
+
+	if len(types) != nl {
+		return typeErr(node, "代入の左辺と右辺の数が一致しません: %d と %d", nl, len(types))
+	}
+
+	for i, l, r := 0, node.Left, node.Right; l != nil; i, l = i+1, l.Next {
+		if l.Kind != NDBlank {
+			if node.Kind == NDVarDecl && l.Var.Type == nil {
+				// 型のないnilからは変数の型が決まらない
+				if types[i] != nil && types[i].Kind == TYNil {
+					return convertDefault(r)
+				}
+
+				l.Var.Type = defaultType(types[i])
+			}
+
+			if err := checkValue(l); err != nil {
+				return err
+			}
+
+			if !addressable(l) {
+				return typeErr(l, "代入できません")
+			}
+
+			if err := checkAssignableType(r, types[i], l.Type); err != nil {
+				return err
+			}
+		} else if err := convertDefault(r); err != nil {
+			return err
+		}
+
+		// 複数の値を返す関数呼び出しでは、右辺は1つのまま
+		if r.Next != nil {
+			r = r.Next
+		}
+	}
+
+	// 右辺を全て評価してから代入するので、左辺と重なりうる値は複製しておく
+	if node.Right.Next != nil {
+		node.Right = copyAggregates(node.Right)
+	}
+
+	return nil
+}
+
+// 複数の語からなる値を一時変数に複製する式で置き換えたリストを返す.
+func copyAggregates(list *Node) *Node {
+	head := &Node{}
+	cur := head
+
+	for node := list; node != nil; {
+		next := node.Next
+
+		if node.Type != nil && node.Type.IsAggregate() {
+			c := NewNode(NDCopy, node, nil, node.Tok)
+			c.Type = node.Type
+			c.Var = newLocalVar(node.Type)
+			cur.Next = c
+		} else {
+			cur.Next = node
+		}
+
+		cur = cur.Next
+		node = next
+	}
+
+	cur.Next = nil
+
+	return head.Next
+}
+
+// 代入や戻り値の右辺の式を検査し、それぞれの値の型を返す
+// n個の値が必要なところに関数呼び出しだけが書かれていれば、
+// その関数の戻り値の型を並べて返す.
+func checkValues(list *Node, n int) ([]*Type, error) {
+	if n > 1 && list != nil && list.Next == nil {
+		if err := checkExpr(list); err != nil {
+			return nil, err
+		}
+
+		if list.Type != nil && list.Type.Kind == TYTuple {
+			types := make([]*Type, len(list.Type.Fields))
+			for i, f := range list.Type.Fields {
+				types[i] = f.Type
+			}
+
+			return types, nil
+		}
+
+		if err := checkSingleValue(list); err != nil {
+			return nil, err
+		}
+
+		return []*Type{list.Type}, nil
+	}
+
+	var types []*Type
+
+	for node := list; node != nil; node = node.Next {
+		if err := checkValue(node); err != nil {
+			return nil, err
+		}
+
+		types = append(types, node.Type)
+	}
+
+	return types, nil
+}
+
+// Nextで繋がったノードの数を数える.
+func listLen(node *Node) int {
+	var n int
+
+	for ; node != nil; node = node.Next {
+		n++
+	}
+
+	return n
+}
+
+// 変数宣言を検査する
+// 初期値がなければゼロ値で初期化される.
+func checkVarDecl(node *Node) error {
+	if node.Right != nil {
+		return checkAssign(node)
+	}
+
+	for l := node.Left; l != nil; l = l.Next {
+		if l.Kind != NDBlank {
+			l.Type = l.Var.Type
+		}
+	}
+
+	return nil
+}
+
+// if, forの条件式を検査する.
+func checkCond(node *Node) error {
+	if err := checkValue(node); err != nil {
+		return err
+	}
+
+	if err := convertDefault(node); err != nil {
+		return err
+	}
+
+	if node.Type != nil && node.Type.Kind != TYBool {
+		return typeErr(node, "条件式がbool型ではありません: %s", node.Type)
+	}
+
+	return nil
+}
+
+// 値として使われる式を検査する.
+func checkValue(node *Node) error {
+	if err := checkExpr(node); err != nil {
+		return err
+	}
+
+	return checkSingleValue(node)
+}
+
+// 検査済みの式が1つの値を持つか調べる.
+func checkSingleValue(node *Node) error {
+	if node.Type == typeVoid {
+		node.Type = nil
+
+		return typeErr(node, "%sは値を返しません", string(node.Name))
+	}
+
+	if node.Type != nil && node.Type.Kind == TYTuple {
+		ty := node.Type
+		node.Type = nil
+
+		return typeErr(node, "複数の値を1つの値として使えません: %s", ty)
+	}
+
+	return nil
+}
+
+// 式の値がty型の変数に代入できるか検査する.
+func checkAssignable(node *Node, ty *Type) error {
+	return checkAssignableType(node, node.Type, ty)
+}
+
+// src型の値がty型の変数に代入できるか検査する
+// 誤りはnodeの位置に報告する.
+func checkAssignableType(node *Node, src *Type, ty *Type) error {
+	if src == nil || ty == nil || identical(src, ty) {
+		return nil
+	}
+
+	if src.IsUntyped() {
+		return convertUntyped(node, ty)
+	}
+
+	if src.Kind == TYNil {
+		return convertNil(node, ty)
+	}
+
+	return typeErr(node, "%s型の値を%s型として使えません", src, ty)
+}
+
+// アドレスを取られる式が領域を使うローカル変数に印を付ける
+// そのような変数は、スコープを抜けた後もポインタから参照されうる.
+func markAddressed(node *Node) {
+	for {
+		switch {
+		case node.Kind == NDLocalV:
+			node.Var.Addressed = true
+
+			return
+		case node.Kind == NDIndex && node.Left.Type != nil && node.Left.Type.Kind == TYArray:
+			node = node.Left
+		case node.Kind == NDMember && node.Left.Type != nil && !node.Left.Type.IsPointer():
+			node = node.Left
+		default:
+			return
+		}
+	}
+}
+
+// アドレスを取れる式であれば真を返す
+// 配列の要素と構造体のフィールドは、配列や構造体自体のアドレスを取れる場合に限る.
+func addressable(node *Node) bool {
+	switch node.Kind {
+	case NDIndex:
+		ty := node.Left.Type
+
+		switch {
+		case ty == nil || ty.IsPointer() || ty.Kind == TYSlice:
+			return true
+		case ty.Kind == TYArray:
+			return addressable(node.Left)
+		}
+
+		return false
+	case NDMember:
+		ty := node.Left.Type
+
+		return ty == nil || ty.IsPointer() || addressable(node.Left)
+	}
+
+	return node.Kind == NDLocalV || node.Kind == NDGlobalV || node.Kind == NDDereference
+}
+
+// パッケージレベルの変数や定数の参照を検査する
+// 宣言を検査していなければ先に検査する
+// 定数の参照は、その値のリテラルで置き換える.
+func checkGlobalRef(node *Node) error {
+	v := node.Var
+
+	// 宣言の左辺であれば、名前は既に結び付いている
+	if v == nil {
+		if v = globalVars[string(node.Name)]; v == nil {
+			return typeErr(node, "未定義の変数です: %s", string(node.Name))
+		}
+
+		if err := checkDecl(v.Decl); err != nil {
+			return err
+		}
+
+		node.Var = v
+	}
+
+	if v.Decl.Kind != NDConstDecl {
+		node.Type = v.Type
+
+		return nil
+	}
+
+	return useConst(node, v)
+}
+
+// 定数vの参照を、その値のリテラルで置き換える.
+func useConst(node *Node, v *Var) error {
+	// 値に誤りがあった定数はnilのまま
+	c := v.Const
+	if c == nil {
+		return nil
+	}
+
+	node.Kind = c.Kind
+	node.Val = c.Val
+	node.Const = c.Const
+	node.Type = c.Type
+
+	// 文字列リテラルの内容はトークンが持っている
+	if c.Kind == NDStr {
+		node.Tok = c.Tok
+	}
+
+	return checkExpr(node)
+}
+
+// 式を検査してnode.Typeを設定する
+// 誤りがあった場合、node.Typeはnilのままにする.
+func checkExpr(node *Node) error {
+	switch node.Kind {
+	case NDNum:
+		// 整数リテラルは型のない定数
+		if node.Type == nil {
+			node.Type = typeUntypedInt
+		}
+
+		if node.Const == nil {
+			node.Const = big.NewInt(int64(node.Val))
+		}
+
+		return nil
+	case NDLocalV:
+		// 配列の長さに使われた定数は、宣言の文より先に検査することがある
+		if decl := node.Var.Decl; decl != nil {
+			if err := checkDecl(decl); err != nil {
+				return err
+			}
+		}
+
+		if node.Var.Const != nil {
+			return useConst(node, node.Var)
+		}
+
+		// 宣言に誤りがあった変数はnilのまま
+		node.Type = node.Var.Type
+
+		return nil
+	case NDGlobalV:
+		return checkGlobalRef(node)
+	case NDNil:
+		node.Type = typeNil
+
+		return nil
+	case NDStr:
+		// 文字列の先頭アドレスと長さを組み立てる領域
+		node.Type = typeString
+		node.Var = newLocalVar(typeString)
+
+		return nil
+	case NDBlank:
+		return typeErr(node, "_は値として使えません")
+	case NDIndex:
+		return checkIndex(node)
+	case NDMember:
+		return checkSelector(node)
+	case NDConv:
+		return checkConv(node)
+	case NDCompLit:
+		return checkCompositeLit(node)
+	case NDSlice:
+		return checkSliceExpr(node)
+	case NDMake:
+		return checkMake(node)
+	case NDAddress:
+		if err := checkValue(node.Left); err != nil {
+			return err
+		}
+
+		// 複合リテラルはアドレスを取るたびに新しい変数になる
+		if !addressable(node.Left) && node.Left.Kind != NDCompLit {
+			return typeErr(node.Left, "アドレスを取得できません")
+		}
+
+		markAddressed(node.Left)
+
+		if node.Left.Type != nil {
+			node.Type = NewPointerType(node.Left.Type)
+		}
+
+		return nil
+	case NDDereference:
+		if err := checkValue(node.Left); err != nil {
+			return err
+		}
+
+		if node.Left.Type == nil {
+			return nil
+		}
+
+		if !node.Left.Type.IsPointer() {
+			return typeErr(node, "ポインタ型ではありません: %s", defaultType(node.Left.Type))
+		}
+
+		node.Type = node.Left.Type.Base
+
+		return nil
+	case NDNot, NDBitNot:
+		return checkUnary(node)
+	case NDFuncCall:
+		return checkFuncCall(node)
+	}
+
+	return checkBinary(node)
+}
+
+func checkFuncCall(node *Node) error {
+	fn, ok := funcDefs[string(node.Name)]
+	if !ok {
+		// 組み込み関数
+		switch string(node.Name) {
+		case "len":
+			return checkLenCap(node, NDLen, TYString, TYArray, TYSlice)
+		case "cap":
+			return checkLenCap(node, NDCap, TYArray, TYSlice)
+		case "append":
+			return checkAppend(node)
+		case "copy":
+			return checkCopy(node)
+		}
+
+		return typeErr(node, "未定義の関数です: %s", string(node.Name))
+	}
+
+	if node.Ellipsis {
+		return typeErr(node, "可変長引数の関数ではありません: %s", string(node.Name))
+	}
+
+	// 複数の値を返す関数呼び出しだけを渡すと、その戻り値が順に引数になる
+	types, err := checkValues(node.Args, listLen(fn.Params))
+	if err != nil {
+		return err
+	}
+
+	param := fn.Params
+
+	for i, arg := 0, node.Args; i < len(types); i++ {
+		if param == nil {
+			return typeErr(arg, "引数が多すぎます")
+		}
+
+		if err := checkAssignableType(arg, types[i], param.Var.Type); err != nil {
+			return err
+		}
+
+		param = param.Next
+
+		if arg.Next != nil {
+			arg = arg.Next
+		}
+	}
+
+	if param != nil {
+		return typeErr(node, "引数が足りません")
+	}
+
+	node.Type = fn.Type
+
+	// 複数の語からなる戻り値を受け取る領域
+	if fn.Type.IsAggregate() {
+		node.Var = newLocalVar(fn.Type)
+	}
+
+	return nil
+}
+
+// 組み込み関数の引数の数を検査し、引数の式を検査する
+// 引数の数が誤っていれば偽を返す.
+func checkBuiltinArgs(node *Node, n int) (bool, error) {
+	if node.Ellipsis {
+		return false, typeErr(node, "%sに...は使えません", string(node.Name))
+	}
+
+	if nargs := listLen(node.Args); nargs != n {
+		if nargs > n {
+			return false, typeErr(node, "引数が多すぎます")
+		}
+
+		return false, typeErr(node, "引数が足りません")
+	}
+
+	for arg := node.Args; arg != nil; arg = arg.Next {
+		if err := checkValue(arg); err != nil {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// len(x), cap(x)を検査する
+// kindsは引数に使える型の種類.
+func checkLenCap(node *Node, kind NodeKind, kinds ...TypeKind) error {
+	if ok, err := checkBuiltinArgs(node, 1); !ok {
+		return err
+	}
+
+	node.Kind = kind
+	node.Left = node.Args
+	node.Type = typeInt
+
+	ty := node.Left.Type
+	if ty == nil {
+		return nil
+	}
+
+	for _, k := range kinds {
+		if ty.Kind == k {
+			return constLen(node)
+		}
+	}
+
+	return typeErr(node.Left, "%sに%s型の値は使えません", string(node.Name), defaultType(ty))
+}
+
+// 文字列定数の長さと、関数呼び出しを含まない式の配列の長さや容量は定数になる.
+func constLen(node *Node) error {
+	x := node.Left
+
+	switch {
+	case x.Kind == NDStr:
+		return setConst(node, big.NewInt(int64(len(x.Tok.Contents))), typeInt)
+	case x.Type.Kind == TYArray && !hasCall(x):
+		return setConst(node, big.NewInt(int64(x.Type.Len)), typeInt)
+	}
+
+	return nil
+}
+
+// 式が関数呼び出しを含めば真を返す.
+func hasCall(node *Node) bool {
+	var found bool
+
+	walk(node, func(n *Node) {
+		switch n.Kind {
+		case NDFuncCall, NDAppend, NDMake, NDSliceCopy:
+			found = true
+		}
+	})
+
+	return found
+}
+
+// append(s, x, ...), append(s, t...)を検査する
+// 結果のスライスを組み立てる一時変数を用意する.
+func checkAppend(node *Node) error {
+	s := node.Args
+	if s == nil {
+		return typeErr(node, "引数が足りません")
+	}
+
+	for arg := s; arg != nil; arg = arg.Next {
+		if err := checkValue(arg); err != nil {
+			return err
+		}
+	}
+
+	ty := s.Type
+	if ty == nil {
+		return nil
+	}
+
+	if ty.Kind != TYSlice {
+		return typeErr(s, "appendの最初の引数がスライスではありません: %s", defaultType(ty))
+	}
+
+	node.Kind = NDAppend
+	node.Type = ty
+	node.Var = newLocalVar(ty)
+
+	if node.Ellipsis {
+		if s.Next == nil || s.Next.Next != nil {
+			return typeErr(node, "...を付けたappendの引数は2つです")
+		}
+
+		return checkCopySource(s.Next, ty)
+	}
+
+	for x := s.Next; x != nil; x = x.Next {
+		if err := checkAssignable(x, ty.Base); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// copy(dst, src)を検査する
+// 複製した要素の数を返す.
+func checkCopy(node *Node) error {
+	if ok, err := checkBuiltinArgs(node, 2); !ok {
+		return err
+	}
+
+	node.Kind = NDSliceCopy
+	node.Type = typeInt
+
+	dst, src := node.Args, node.Args.Next
+	if dst.Type == nil || src.Type == nil {
+		return nil
+	}
+
+	if dst.Type.Kind != TYSlice {
+		return typeErr(dst, "copyの複製先がスライスではありません: %s", defaultType(dst.Type))
+	}
+
+	return checkCopySource(src, dst.Type)
+}
+
+// dst型のスライスに要素を複製する元の値を検査する
+// 要素の型が同じスライスか、[]byteに対する文字列を使える.
+func checkCopySource(src *Node, dst *Type) error {
+	ty := src.Type
+
+	switch {
+	case ty == nil:
+		return nil
+	case ty.Kind == TYSlice && identical(ty.Base, dst.Base):
+		return nil
+	case ty.Kind == TYString && dst.Base.Kind == TYByte:
+		return nil
+	}
+
+	return typeErr(src, "%s型の値の要素を%s型に複製できません", defaultType(ty), dst)
+}
+
+// make(T, len, cap)を検査する
+// 作ったスライスを置く一時変数を用意する.
+func checkMake(node *Node) error {
+	ty := node.Type
+	node.Type = nil
+
+	if ty.Kind != TYSlice {
+		return typeErr(node, "makeで作れない型です: %s", ty)
+	}
+
+	if node.Ellipsis {
+		return typeErr(node, "makeに...は使えません")
+	}
+
+	switch n := listLen(node.Args); {
+	case n == 0:
+		return typeErr(node, "引数が足りません")
+	case n > 2:
+		return typeErr(node, "引数が多すぎます")
+	}
+
+	for arg := node.Args; arg != nil; arg = arg.Next {
+		if err := checkValue(arg); err != nil {
+			return err
+		}
+
+		if arg.Type != nil && !arg.Type.IsInteger() {
+			return typeErr(arg, "makeの大きさが整数ではありません: %s", arg.Type)
+		}
+
+		if err := convertDefault(arg); err != nil {
+			return err
+		}
+	}
+
+	if l, c := node.Args, node.Args.Next; c != nil && l.Kind == NDNum && c.Kind == NDNum && l.Val > c.Val {
+		return typeErr(l, "lenがcapより大きいです: %d > %d", l.Val, c.Val)
+	}
+
+	node.Type = ty
+	node.Var = newLocalVar(ty)
+
+	return nil
+}
+
+// スライス式を検査する
+// 配列をスライスするには、配列のアドレスを取れなければならない.
+func checkSliceExpr(node *Node) error {
+	if err := checkValue(node.Left); err != nil {
+		return err
+	}
+
+	for _, index := range []*Node{node.Low, node.High, node.Max} {
+		if index == nil {
+			continue
+		}
+
+		if err := checkValue(index); err != nil {
+			return err
+		}
+
+		if index.Type != nil && !index.Type.IsInteger() {
+			return typeErr(index, "添字が整数ではありません: %s", index.Type)
+		}
+
+		if err := convertDefault(index); err != nil {
+			return err
+		}
+	}
+
+	ty := node.Left.Type
+
+	switch {
+	case ty == nil:
+		return nil
+	case ty.Kind == TYString:
+		if node.Max != nil {
+			return typeErr(node.Max, "文字列のスライス式に3つの添字は使えません")
+		}
+
+		node.Type = typeString
+	case ty.Kind == TYSlice:
+		node.Type = ty
+	case ty.Kind == TYArray:
+		if !addressable(node.Left) {
+			return typeErr(node.Left, "アドレスを取得できない配列はスライスできません")
+		}
+
+		markAddressed(node.Left)
+
+		node.Type = NewSliceType(ty.Base)
+	case ty.IsPointer() && ty.Base.Kind == TYArray:
+		node.Type = NewSliceType(ty.Base.Base)
+	default:
+		return typeErr(node, "スライスできません: %s", defaultType(ty))
+	}
+
+	node.Var = newLocalVar(node.Type)
+
+	return nil
+}
+
+// 型変換を検査する
+// 同一の型の間と、整数型どうしの間で変換できる
+// nilはポインタ型とスライス型に変換できる.
+func checkConv(node *Node) error {
+	if err := checkValue(node.Left); err != nil {
+		return err
+	}
+
+	src, ty := node.Left.Type, node.Type
+	if src == nil {
+		return nil
+	}
+
+	if src.Kind == TYNil && ty.IsNilable() {
+		return convertNil(node.Left, ty)
+	}
+
+	if !identical(src, ty) && !(src.IsInteger() && ty.IsInteger()) {
+		return typeErr(node, "%s型の値を%s型に変換できません", src, ty)
+	}
+
+	// 定数の変換は、値を変換先の型で表せる場合に限り定数になる
+	if node.Left.Kind == NDNum {
+		return setConst(node, node.Left.Const, ty)
+	}
+
+	return nil
+}
+
+// 複合リテラルを検査する
+// 値を組み立てる一時変数を用意する.
+func checkCompositeLit(node *Node) error {
+	ty := node.Type
+	node.Var = newLocalVar(ty)
+
+	if ty.Kind == TYStruct {
+		return checkStructLit(node)
+	}
+
+	var i int
+
+	for elem := node.Args; elem != nil; elem = elem.Next {
+		if ty.Kind == TYArray && i == ty.Len {
+			return typeErr(elem, "配列の要素が多すぎます: %d個まで", ty.Len)
+		}
+
+		if err := checkValue(elem); err != nil {
+			return err
+		}
+
+		if err := checkAssignable(elem, ty.Base); err != nil {
+			return err
+		}
+
+		i++
+	}
+
+	return nil
+}
+
+// 構造体の複合リテラルの要素を検査する
+// 要素はすべてフィールド名付きか、すべてのフィールドを順に並べたものでなければならない
+// 名前の付いていないフィールドはゼロ値になる.
+func checkStructLit(node *Node) error {
+	ty := node.Type
+	keyed := node.Args != nil && node.Args.Kind == NDKeyVal
+	seen := make(map[string]bool)
+
+	var i int
+
+	for elem := node.Args; elem != nil; elem = elem.Next {
+		if (elem.Kind == NDKeyVal) != keyed {
+			return typeErr(elem, "フィールド名の付いた要素と付いていない要素を混ぜられません")
+		}
+
+		val := elem
+
+		var f *Field
+
+		if keyed {
+			name := string(elem.Name)
+
+			if f = ty.FindField(elem.Name); f == nil {
+				return typeErr(elem, "%s型にフィールド%sはありません", ty, name)
+			}
+
+			if seen[name] {
+				return typeErr(elem, "フィールド%sが重複しています", name)
+			}
+
+			seen[name] = true
+			val = elem.Left
+		} else {
+			if i == len(ty.Fields) {
+				return typeErr(elem, "構造体の要素が多すぎます: %d個まで", len(ty.Fields))
+			}
+
+			f = ty.Fields[i]
+		}
+
+		if err := checkValue(val); err != nil {
+			return err
+		}
+
+		if err := checkAssignable(val, f.Type); err != nil {
+			return err
+		}
+
+		i++
+	}
+
+	if !keyed && i > 0 && i < len(ty.Fields) {
+		return typeErr(node, "構造体の要素が足りません: %d個必要です", len(ty.Fields))
+	}
+
+	return nil
+}
+
+// セレクタ式x.fを検査する
+// 構造体へのポインタは自動的に参照外しする.
+func checkSelector(node *Node) error {
+	if err := checkValue(node.Left); err != nil {
+		return err
+	}
+
+	ty := node.Left.Type
+	if ty == nil {
+		return nil
+	}
+
+	if ty.IsPointer() {
+		ty = ty.Base
+	}
+
+	if ty.Kind != TYStruct {
+		return typeErr(node, "%s型の値にフィールドはありません", defaultType(node.Left.Type))
+	}
+
+	f := selectedField(node)
+	if f == nil {
+		return typeErr(node, "%s型にフィールド%sはありません", ty, string(node.Name))
+	}
+
+	node.Type = f.Type
+
+	return nil
+}
+
+// セレクタ式で選ぶフィールド.
+func selectedField(node *Node) *Field {
+	ty := node.Left.Type
+	if ty.IsPointer() {
+		ty = ty.Base
+	}
+
+	return ty.FindField(node.Name)
+}
+
+// 添字式を検査する
+// 文字列の要素はbyte型で、代入はできない
+// スライスの要素には常に代入できる
+// 配列へのポインタは自動的に参照外しする.
+func checkIndex(node *Node) error {
+	if err := checkValue(node.Left); err != nil {
+		return err
+	}
+
+	if err := checkValue(node.Right); err != nil {
+		return err
+	}
+
+	if ty := node.Right.Type; ty != nil && !ty.IsInteger() {
+		return typeErr(node.Right, "添字が整数ではありません: %s", ty)
+	}
+
+	if err := convertDefault(node.Right); err != nil {
+		return err
+	}
+
+	ty := node.Left.Type
+	if ty == nil {
+		return nil
+	}
+
+	switch {
+	case ty.Kind == TYString:
+		node.Type = typeByte
+
+		return nil
+	case ty.Kind == TYSlice:
+		node.Type = ty.Base
+
+		return nil
+	case ty.IsPointer() && ty.Base.Kind == TYArray:
+		ty = ty.Base
+	case ty.Kind != TYArray:
+		return typeErr(node, "添字を使えません: %s", defaultType(ty))
+	}
+
+	node.Type = ty.Base
+
+	// 定数の添字は範囲外であれば誤りにする
+	if index := node.Right; index.Kind == NDNum && (index.Val < 0 || index.Val >= ty.Len) {
+		return typeErr(index, "添字が範囲外です: %d (長さ%d)", index.Val, ty.Len)
+	}
+
+	return nil
+}
+
+// 添字式の対象の配列型
+// 配列へのポインタであれば指す先の型を返す.
+func indexedArray(node *Node) *Type {
+	if ty := node.Left.Type; ty.IsPointer() {
+		return ty.Base
+	}
+
+	return node.Left.Type
+}
+
+// 型検査中の関数に名前のない一時変数を追加する.
+func newLocalVar(ty *Type) *Var {
+	v := &Var{Type: ty, Next: currentFunc.Locals}
+
+	currentFunc.Locals = v
+
+	return v
+}
+
+// 単項演算子を検査する.
+func checkUnary(node *Node) error {
+	if err := checkValue(node.Left); err != nil {
+		return err
+	}
+
+	ty := node.Left.Type
+	if ty == nil {
+		return nil
+	}
+
+	op := string(node.Tok.Str)
+
+	switch node.Kind {
+	case NDNot:
+		if ty.Kind != TYBool {
+			return typeErr(node, "演算子%sは%s型に使えません", op, defaultType(ty))
+		}
+	case NDBitNot:
+		if !ty.IsInteger() {
+			return typeErr(node, "演算子%sは%s型に使えません", op, ty)
+		}
+	}
+
+	node.Type = ty
+
+	return foldConst(node)
+}
+
+// 二項演算子を検査する.
+func checkBinary(node *Node) error {
+	if err := checkValue(node.Left); err != nil {
+		return err
+	}
+
+	if err := checkValue(node.Right); err != nil {
+		return err
+	}
+
+	left, right := node.Left.Type, node.Right.Type
+	if left == nil || right == nil {
+		return nil
+	}
+
+	op := string(node.Tok.Str)
+
+	// シフト演算子の両辺の型は一致しなくてよい
+	if node.Kind == NDShl || node.Kind == NDShr {
+		if !left.IsInteger() {
+			return typeErr(node, "演算子%sは%s型に使えません", op, left)
+		}
+
+		if !right.IsInteger() {
+			return typeErr(node.Right, "シフト数が整数ではありません: %s", right)
+		}
+
+		if count := node.Right; count.Kind == NDNum && count.Const.Sign() < 0 {
+			return typeErr(count, "シフト数が負です: %s", count.Const)
+		}
+
+		if err := convertDefault(node.Right); err != nil {
+			return err
+		}
+
+		// シフト数が定数でなければ、型のない定数は既定の型の値としてシフトする
+		if node.Right.Kind != NDNum {
+			if err := convertDefault(node.Left); err != nil {
+				return err
+			}
+		}
+
+		if node.Left.Type == nil || node.Right.Type == nil {
+			return nil
+		}
+
+		node.Type = node.Left.Type
+
+		return foldConst(node)
+	}
+
+	if err := unifyNil(node); err != nil {
+		return err
+	}
+
+	if err := unifyUntyped(node); err != nil {
+		return err
+	}
+
+	left, right = node.Left.Type, node.Right.Type
+	if left == nil || right == nil {
+		return nil
+	}
+
+	if !identical(left, right) {
+		return typeErr(node, "型が一致しません: %s と %s", left, right)
+	}
+
+	switch node.Kind {
+	case NDAdd:
+		if !left.IsInteger() && left.Kind != TYString {
+			return typeErr(node, "演算子%sは%s型に使えません", op, left)
+		}
+
+		// 連結した文字列の先頭アドレスと長さを置く領域
+		if left.Kind == TYString {
+			node.Var = newLocalVar(typeString)
+		}
+
+		node.Type = left
+	case NDSub, NDMul, NDDiv, NDMod, NDBitAnd, NDBitOr, NDBitXor, NDAndNot:
+		if !left.IsInteger() {
+			return typeErr(node, "演算子%sは%s型に使えません", op, left)
+		}
+
+		if (node.Kind == NDDiv || node.Kind == NDMod) && node.Right.Kind == NDNum && node.Right.Const.Sign() == 0 {
+			return typeErr(node.Right, "0で除算しています")
+		}
+
+		node.Type = left
+	case NDEq, NDNe:
+		// スライスはnilとだけ比較できる
+		if left.Kind == TYSlice && node.Left.Kind != NDNil && node.Right.Kind != NDNil {
+			return typeErr(node, "演算子%sは%s型に使えません", op, left)
+		}
+
+		if left.Kind == TYArray || left.Kind == TYStruct || left.Kind == TYNil {
+			return typeErr(node, "演算子%sは%s型に使えません", op, left)
+		}
+
+		node.Type = typeBool
+	case NDLt, NDLe:
+		if !left.IsInteger() && left.Kind != TYString {
+			return typeErr(node, "演算子%sは%s型に使えません", op, left)
+		}
+
+		node.Type = typeBool
+	case NDLogAnd, NDLogOr:
+		if left.Kind != TYBool {
+			return typeErr(node, "演算子%sは%s型に使えません", op, left)
+		}
+
+		node.Type = typeBool
+	}
+
+	return foldConst(node)
+}
+
+// 二項演算子の被演算子の一方だけがnilであれば、もう一方の型のnilにする.
+func unifyNil(node *Node) error {
+	l, r := node.Left, node.Right
+
+	switch {
+	case l.Type.Kind == TYNil && r.Type.IsNilable():
+		return convertNil(l, r.Type)
+	case r.Type.Kind == TYNil && l.Type.IsNilable():
+		return convertNil(r, l.Type)
+	}
+
+	return nil
+}
+
+// 二項演算子の被演算子の一方だけが型のない定数であれば、もう一方の型の値にする
+// もう一方が整数型でなければ既定の型の値にする
+// 両方とも型のない定数であれば、文字定数を含む場合は文字定数にそろえる.
+func unifyUntyped(node *Node) error {
+	l, r := node.Left, node.Right
+
+	switch {
+	case l.Type.IsUntyped() && r.Type.IsUntyped():
+		if l.Type.Kind == TYUntypedRune {
+			r.Type = l.Type
+		} else {
+			l.Type = r.Type
+		}
+	case l.Type.IsUntyped():
+		if r.Type.IsInteger() {
+			return convertUntyped(l, r.Type)
+		}
+
+		return convertDefault(l)
+	case r.Type.IsUntyped():
+		if l.Type.IsInteger() {
+			return convertUntyped(r, l.Type)
+		}
+
+		return convertDefault(r)
+	}
+
+	return nil
+}
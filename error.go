@@ -3,23 +3,181 @@ package main
 import (
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
 )
 
 var (
 	ErrIncorrectNumberArgument = errors.New("the number of arguments is not correct")
-	ErrNoInt                   = errors.New("this is not integer")
+	ErrNotGoFile               = errors.New("this is not a .go file")
+	ErrTooManyErrors           = errors.New("too many errors")
+	ErrUnknownABI              = errors.New("unknown ABI")
 )
 
-type UserInput string
+// ソースファイル1つ分の入力.
+type UserInput struct {
+	Name string
+	Src  string
 
-func (ui UserInput) Err(loc int, message string) error {
-	body := fmt.Sprintf(`%s
-%s^ %s`, ui, strings.Repeat(" ", loc), message)
+	// 各行の先頭のバイトオフセット.
+	lines []int
+}
+
+func NewUserInput(name string, src string) *UserInput {
+	lines := []int{0}
+
+	for i := 0; i < len(src); i++ {
+		if src[i] == '\n' {
+			lines = append(lines, i+1)
+		}
+	}
+
+	return &UserInput{
+		Name:  name,
+		Src:   src,
+		lines: lines,
+	}
+}
+
+// バイトオフセットから行と列を求める.
+func (ui *UserInput) Pos(loc int) Pos {
+	line := sort.Search(len(ui.lines), func(i int) bool { return ui.lines[i] > loc }) - 1
+
+	return Pos{
+		Input: ui,
+		Loc:   loc,
+		Line:  line + 1,
+		Col:   loc - ui.lines[line] + 1,
+	}
+}
+
+// 指定した行(1始まり)の内容を改行を除いて返す.
+func (ui *UserInput) Line(line int) string {
+	start := ui.lines[line-1]
+	end := len(ui.Src)
+
+	if line < len(ui.lines) {
+		end = ui.lines[line] - 1
+	}
+
+	return strings.TrimSuffix(ui.Src[start:end], "\r")
+}
 
-	return InvalidInputError{s: body}
+func (ui *UserInput) Err(loc int, message string) error {
+	return ui.Pos(loc).Err(message)
 }
 
-type InvalidInputError struct{ s string }
+// ソースコード上の位置.
+type Pos struct {
+	Input *UserInput
+	Loc   int // ファイル先頭からのバイトオフセット
+	Line  int // 1始まりの行番号
+	Col   int // 1始まりの列番号(バイト単位)
+}
+
+func (p Pos) String() string {
+	return fmt.Sprintf("%s:%d:%d", p.Input.Name, p.Line, p.Col)
+}
+
+func (p Pos) Err(message string) error {
+	return InvalidInputError{Pos: p, Msg: message}
+}
+
+// ソースコードの誤りを表す
+// "file:line:col: message"の後に該当行とキャレットを出力する.
+type InvalidInputError struct {
+	Pos Pos
+	Msg string
+}
+
+func (e InvalidInputError) Error() string {
+	line := e.Pos.Input.Line(e.Pos.Line)
+
+	// タブ幅がずれないように、キャレットまでの空白はタブをそのまま残す
+	indent := []rune{}
+
+	for i := 0; i < e.Pos.Col-1 && i < len(line); i++ {
+		if line[i] == '\t' {
+			indent = append(indent, '\t')
+		} else {
+			indent = append(indent, ' ')
+		}
+	}
+
+	return fmt.Sprintf(`%s: %s
+%s
+%s^`, e.Pos, e.Msg, line, string(indent))
+}
 
-func (e InvalidInputError) Error() string { return e.s }
+// 報告するエラー数の上限
+// 0の場合は上限なし.
+var errorLimit = defaultErrorLimit
+
+const defaultErrorLimit = 10
+
+// 1回の実行で見つかったエラーの一覧
+// 位置順に並べて出力する.
+type ErrorList []InvalidInputError
+
+// エラーを一覧に追加する
+// InvalidInputError以外のエラーはそのまま返し、上限を超えた場合は一覧自体を返す.
+func (l *ErrorList) Add(err error) error {
+	var e InvalidInputError
+	if !errors.As(err, &e) {
+		return err
+	}
+
+	*l = append(*l, e)
+
+	if errorLimit > 0 && len(*l) > errorLimit {
+		return *l
+	}
+
+	return nil
+}
+
+// エラーがあれば一覧をerrorとして返す.
+func (l ErrorList) Err() error {
+	if len(l) == 0 {
+		return nil
+	}
+
+	return l
+}
+
+func (l ErrorList) Len() int      { return len(l) }
+func (l ErrorList) Swap(i, j int) { l[i], l[j] = l[j], l[i] }
+
+func (l ErrorList) Less(i, j int) bool {
+	a, b := l[i].Pos, l[j].Pos
+
+	if a.Input.Name != b.Input.Name {
+		return a.Input.Name < b.Input.Name
+	}
+
+	if a.Line != b.Line {
+		return a.Line < b.Line
+	}
+
+	return a.Col < b.Col
+}
+
+func (l ErrorList) Error() string {
+	errs := make(ErrorList, len(l))
+	copy(errs, l)
+	sort.Stable(errs)
+
+	msgs := make([]string, 0, len(errs)+1)
+
+	for i, e := range errs {
+		if errorLimit > 0 && i >= errorLimit {
+			msgs = append(msgs, ErrTooManyErrors.Error())
+
+			break
+		}
+
+		msgs = append(msgs, e.Error())
+	}
+
+	return strings.Join(msgs, "\n")
+}
@@ -1,10 +1,13 @@
 package main
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
-var argReg = []string{"rdi", "rsi", "rdx", "rcx", "r8", "r9"}
+// ジャンプテーブルを使うswitch文のcaseの値の最小の個数.
+const minJumpTableCases = 4
 
-// TODO: ABIをGoに合わせる
 func generate(nodes *Node) error {
 	output.L(".intel_syntax noprefix")
 
@@ -16,23 +19,257 @@ func generate(nodes *Node) error {
 		}
 	}
 
+	if initFunc.Body != nil {
+		if err := genFunction(initFunc); err != nil {
+			return err
+		}
+	}
+
+	genMainWrapper()
+
+	genGlobals(nodes)
+	genStringLiterals()
+	genRuntime()
+
+	return nil
+}
+
+// 関数のシンボル名
+// 実行時ライブラリが呼ぶCの関数名と衝突しないように、パッケージ名を接頭辞にする.
+func funcSymbol(name []rune) string {
+	return "main." + string(name)
+}
+
+// パッケージレベルの変数のシンボル名
+// レジスタ名や演算子、実行時ライブラリが呼ぶCの関数名と衝突しないように、
+// 識別子をそのまま使わずアセンブラのローカルな名前にする.
+func varSymbol(v *Var) string {
+	return ".L.var." + string(v.Name)
+}
+
+// パッケージレベルの変数の領域を置く
+// 初期値が定数の変数は.dataに値を置き、それ以外は.bssに置いて実行時に初期化する.
+func genGlobals(nodes *Node) {
+	for node := nodes; node != nil; node = node.Next {
+		if node.Kind != NDVarDecl {
+			continue
+		}
+
+		static := staticInit(node)
+
+		for l, r := node.Left, node.Right; l != nil; l = l.Next {
+			if l.Kind != NDBlank {
+				v := l.Var
+
+				if static && r != nil {
+					output.L("  .data")
+					output.F("  .align %d\n", v.Type.Align)
+					output.F("%s:\n", varSymbol(v))
+					genData(r)
+				} else {
+					output.L("  .bss")
+					output.F("  .align %d\n", v.Type.Align)
+					output.F("%s:\n", varSymbol(v))
+					output.F("  .zero %d\n", v.Type.Size)
+				}
+			}
+
+			if r != nil {
+				r = r.Next
+			}
+		}
+	}
+
+	output.L("  .text")
+}
+
+// 定数の初期値をデータとして置く
+// 複合リテラルは要素を順に置き、値のない要素や境界に揃えるための隙間は0で埋める.
+func genData(node *Node) {
+	ty := node.Type
+
+	switch node.Kind {
+	case NDNum:
+		output.F("  %s %d\n", dataDirective(ty.Size), node.Val)
+	case NDStr:
+		// 文字列の先頭アドレスと長さ
+		node.Label = uniqueLabel()
+		stringLiterals = append(stringLiterals, node)
+
+		output.F("  .quad .L.str.%s\n", node.Label)
+		output.F("  .quad %d\n", len(node.Tok.Contents))
+	case NDNil:
+		output.F("  .zero %d\n", ty.Size)
+	case NDCopy:
+		genData(node.Left)
+	case NDCompLit:
+		if ty.Kind == TYStruct {
+			genStructData(node)
+
+			return
+		}
+
+		n := 0
+
+		for elem := node.Args; elem != nil; elem = elem.Next {
+			genData(elem)
+			n++
+		}
+
+		if n < ty.Len {
+			output.F("  .zero %d\n", (ty.Len-n)*ty.Base.Size)
+		}
+	}
+}
+
+// 構造体の複合リテラルの値を、フィールドの順に置く.
+func genStructData(node *Node) {
+	ty := node.Type
+
+	var offset int
+
+	for i, f := range ty.Fields {
+		if f.Offset > offset {
+			output.F("  .zero %d\n", f.Offset-offset)
+		}
+
+		if val := fieldValue(node, i); val != nil {
+			genData(val)
+		} else if f.Type.Size > 0 {
+			output.F("  .zero %d\n", f.Type.Size)
+		}
+
+		offset = f.Offset + f.Type.Size
+	}
+
+	if ty.Size > offset {
+		output.F("  .zero %d\n", ty.Size-offset)
+	}
+}
+
+// 構造体の複合リテラルで、i番目のフィールドに与えられた値を返す
+// 値がなければnilを返す.
+func fieldValue(node *Node, i int) *Node {
+	name := node.Type.Fields[i].Name
+
+	for j, elem := 0, node.Args; elem != nil; j, elem = j+1, elem.Next {
+		if elem.Kind != NDKeyVal {
+			if j == i {
+				return elem
+			}
+
+			continue
+		}
+
+		if string(elem.Name) == string(name) {
+			return elem.Left
+		}
+	}
+
 	return nil
 }
 
+// 大きさがsizeの整数を置く疑似命令.
+func dataDirective(size int) string {
+	switch size {
+	case 1:
+		return ".byte"
+	case 4:
+		return ".long"
+	}
+
+	return ".quad"
+}
+
+// 文字列リテラルの内容を読み出し専用の領域に置く.
+func genStringLiterals() {
+	if len(stringLiterals) == 0 {
+		return
+	}
+
+	output.L("  .section .rodata")
+
+	for _, node := range stringLiterals {
+		output.F(".L.str.%s:\n", node.Label)
+
+		if len(node.Tok.Contents) == 0 {
+			continue
+		}
+
+		bytes := make([]string, len(node.Tok.Contents))
+		for i, c := range node.Tok.Contents {
+			bytes[i] = fmt.Sprint(c)
+		}
+
+		output.F("  .byte %s\n", strings.Join(bytes, ","))
+	}
+
+	output.L("  .text")
+}
+
+// Cのmain関数からmain.mainを呼び出す
+// Cの呼び出し規約で保存すべきレジスタを退避しておく.
+func genMainWrapper() {
+	saved := []string{"rbx", "r12", "r13", "r14", "r15"}
+
+	output.L(".global main")
+	output.L("main:")
+	output.L("  push rbp")
+	output.L("  mov rbp, rsp")
+
+	for _, reg := range saved {
+		output.F("  push %s\n", reg)
+	}
+
+	// 呼び出し時のrspを16バイト境界に揃える
+	output.L("  sub rsp, 8")
+	output.F("  call %s\n", funcSymbol([]rune("main")))
+	output.L("  add rsp, 8")
+
+	for i := len(saved) - 1; i >= 0; i-- {
+		output.F("  pop %s\n", saved[i])
+	}
+
+	output.L("  pop rbp")
+	output.L("  ret")
+}
+
 func genFunction(node *Node) error {
-	funcName := string(node.Name)
+	currentFunc = node
+
+	funcName := funcSymbol(node.Name)
 	output.F(".global %s\n", funcName)
 	output.F("%s:\n", funcName)
 
+	layoutFunction(node)
+
 	output.L("  push rbp")
 	output.L("  mov rbp, rsp")
 	output.F("  sub rsp, %d\n", node.Size)
 
-	var i int
+	vars, locs, _ := paramWords(node)
 
-	for p := node.Params; p != nil; p = p.Next {
-		output.F("  mov [rbp-%d], %s\n", p.Offset, argReg[i])
-		i++
+	for i, v := range vars {
+		for k, loc := range locs[i] {
+			reg := loc.Reg
+
+			// レジスタに収まらない引数は戻りアドレスの上に並んでいる
+			if reg == "" {
+				reg = abi.Scratch[0]
+				output.F("  mov %s, [rbp+%d]\n", reg, 16+8*loc.Stack)
+			}
+
+			if v.Type.IsAggregate() {
+				storeWord(fmt.Sprintf("rbp-%d", v.Offset-8*k), reg, v.Type.Size-8*k)
+			} else {
+				store(v.Type, fmt.Sprintf("rbp-%d", v.Offset), reg)
+			}
+		}
+	}
+
+	// パッケージレベルの変数を初期化してからmainを実行する
+	if string(node.Name) == "main" && initFunc.Body != nil {
+		output.F("  call %s\n", funcSymbol(initFunc.Name))
 	}
 
 	for body := node.Body; body != nil; body = body.Next {
@@ -42,6 +279,12 @@ func genFunction(node *Node) error {
 	}
 
 	output.F(".L.return.%s:\n", funcName)
+
+	// 戻り値のないmainは終了コード0で終わる
+	if string(node.Name) == "main" && node.Type == typeVoid {
+		output.L("  mov rax, 0")
+	}
+
 	output.L("  mov rsp, rbp")
 	output.L("  pop rbp")
 	output.L("  ret")
@@ -49,39 +292,44 @@ func genFunction(node *Node) error {
 	return nil
 }
 
+// 文のコードを生成する
+// 文の前後でスタックの深さは変わらない.
 func genStmt(node *Node) error {
 	switch node.Kind {
-	case NDNum:
-		output.F("  push %d\n", node.Val)
-
-		return nil
-	case NDLocalV:
-		if err := genLocalValue(node); err != nil {
-			return err
+	case NDVarDecl:
+		if node.Right != nil {
+			return genAssign(node)
 		}
 
-		output.L("  pop rax")
-		output.L("  mov rax, [rax]")
-		output.L("  push rax")
+		for l := node.Left; l != nil; l = l.Next {
+			if l.Kind == NDBlank {
+				continue
+			}
 
-		return nil
-	case NDAssign:
-		if err := genLocalValue(node.Left); err != nil {
-			return err
-		}
+			if err := genAddr(l); err != nil {
+				return err
+			}
 
-		if err := genStmt(node.Right); err != nil {
-			return err
+			output.L("  pop rax")
+			zero(l.Type, "rax")
 		}
 
-		output.L("  pop rdi")
-		output.L("  pop rax")
-		output.L("  mov [rax], rdi")
-		output.L("  push rdi")
-
+		return nil
+	case NDConstDecl:
+		// 定数の参照は型検査で値に置き換えてある
 		return nil
 	case NDReturn:
-		if err := genStmt(node.Left); err != nil {
+		if node.Left == nil {
+			output.F("  jmp .L.return.%s\n", funcSymbol(currentFunc.Name))
+
+			return nil
+		}
+
+		if currentFunc.Type.IsAggregate() {
+			return genReturnAggregate(node)
+		}
+
+		if err := genExpr(node.Left); err != nil {
 			return err
 		}
 
@@ -92,7 +340,13 @@ func genStmt(node *Node) error {
 
 		return nil
 	case NDIf:
-		if err := genStmt(node.Cond); err != nil {
+		if node.Init != nil {
+			if err := genStmt(node.Init); err != nil {
+				return err
+			}
+		}
+
+		if err := genExpr(node.Cond); err != nil {
 			return err
 		}
 
@@ -128,7 +382,7 @@ func genStmt(node *Node) error {
 
 		return nil
 	case NDFor:
-		label := uniqueLabel()
+		node.Label = uniqueLabel()
 
 		if node.Init != nil {
 			if err := genStmt(node.Init); err != nil {
@@ -136,30 +390,47 @@ func genStmt(node *Node) error {
 			}
 		}
 
-		output.F(".L.begin.%s:\n", label)
+		output.F(".L.begin.%s:\n", node.Label)
 
 		if node.Cond != nil {
-			if err := genStmt(node.Cond); err != nil {
+			if err := genExpr(node.Cond); err != nil {
 				return err
 			}
 
-			output.L("pop rax")
-			output.L("cmp rax, 0")
-			output.F("je .L.end.%s\n", label)
+			output.L("  pop rax")
+			output.L("  cmp rax, 0")
+			output.F("  je  .L.end.%s\n", node.Label)
 		}
 
 		if err := genStmt(node.Then); err != nil {
 			return err
 		}
 
+		output.F(".L.continue.%s:\n", node.Label)
+
 		if node.Inc != nil {
 			if err := genStmt(node.Inc); err != nil {
 				return err
 			}
 		}
 
-		output.F("jmp .L.begin.%s\n", label)
-		output.F(".L.end.%s:\n", label)
+		output.F("  jmp .L.begin.%s\n", node.Label)
+		output.F(".L.end.%s:\n", node.Label)
+
+		return nil
+	case NDAssign:
+		return genAssign(node)
+	case NDSwitch:
+		return genSwitch(node)
+	case NDFallthrough:
+		// 次の節の本体がすぐ後ろに続く
+		return nil
+	case NDBreak:
+		output.F("  jmp .L.end.%s\n", node.Target.Label)
+
+		return nil
+	case NDContinue:
+		output.F("  jmp .L.continue.%s\n", node.Target.Label)
 
 		return nil
 	case NDBlock:
@@ -170,110 +441,1473 @@ func genStmt(node *Node) error {
 		}
 
 		return nil
-	case NDFuncCall:
-		var nargs int
+	}
 
-		for arg := node.Args; arg != nil; arg = arg.Next {
-			if err := genStmt(arg); err != nil {
-				return err
-			}
-			nargs++
+	// 式文の値は捨てる
+	if err := genExpr(node); err != nil {
+		return err
+	}
+
+	output.L("  add rsp, 8")
+
+	return nil
+}
+
+// 代入文と、初期値のある変数宣言のコードを生成する
+// 左辺のアドレスと右辺の値をすべてスタックに積んでから、左から順に代入する.
+func genAssign(node *Node) error {
+	var n int
+
+	for l := node.Left; l != nil; l = l.Next {
+		// _には代入しないので、アドレスの代わりに0を積んでおく
+		if l.Kind == NDBlank {
+			output.L("  push 0")
+		} else if err := genAddr(l); err != nil {
+			return err
 		}
 
-		for i := nargs - 1; i >= 0; i-- {
-			output.F("  pop %s\n", argReg[i])
+		n++
+	}
+
+	// 右辺が複数の値を返す関数呼び出しの場合、
+	// 戻り値の置かれた領域から順に取り出す
+	if ty := node.Right.Type; ty.Kind == TYTuple {
+		if err := genExpr(node.Right); err != nil {
+			return err
 		}
 
-		label := uniqueLabel()
+		output.L("  pop rdx")
+
+		for i, l := 0, node.Left; l != nil; i, l = i+1, l.Next {
+			if l.Kind != NDBlank {
+				f := ty.Fields[i]
 
-		output.F("  mov rax, rsp\n")
-		output.F("  and rax, 15\n")
-		output.F("  jnz .L.call.%s\n", label)
-		output.F("  mov rax, 0\n")
-		output.F("  call %s\n", string(node.Name))
-		output.F("  jmp .L.end.%s\n", label)
-		output.F(".L.call.%s:\n", label)
-		output.F("  sub rsp, 8\n")
-		output.F("  mov rax, 0\n")
-		output.F("  call %s\n", string(node.Name))
-		output.F("  add rsp, 8\n")
-		output.F(".L.end.%s:\n", label)
-		output.F("  push rax\n")
+				output.F("  mov rax, [rsp+%d]\n", 8*(n-1-i))
+				load(f.Type, "rdi", fmt.Sprintf("rdx+%d", f.Offset))
+				store(l.Type, "rax", "rdi")
+			}
+		}
+
+		output.F("  add rsp, %d\n", 8*n)
 
 		return nil
+	}
 
-	case NDAddress:
-		if err := genLocalValue(node.Left); err != nil {
+	for r := node.Right; r != nil; r = r.Next {
+		if err := genExpr(r); err != nil {
 			return err
 		}
+	}
 
-		return nil
-	case NDDereference:
-		if err := genStmt(node.Left); err != nil {
-			return err
+	for i, l := 0, node.Left; l != nil; i, l = i+1, l.Next {
+		if l.Kind != NDBlank {
+			output.F("  mov rax, [rsp+%d]\n", 8*(2*n-1-i))
+			output.F("  mov rdi, [rsp+%d]\n", 8*(n-1-i))
+			store(l.Type, "rax", "rdi")
 		}
+	}
 
-		output.L("  pop rax")
-		output.L("  mov rax, [rax]")
-		output.L("  push rax")
+	output.F("  add rsp, %d\n", 16*n)
 
-		return nil
+	return nil
+}
+
+// 引数や戻り値の1語の受け渡し場所
+// Regが空の場合は、スタック上で何語目にあたるかをStackで表す.
+type wordLoc struct {
+	Reg   string
+	Stack int
+}
+
+// 順に並んだ値の各語をregsとスタックに割り当てる
+// 1つの値は、すべての語がレジスタに収まる場合にだけレジスタで渡す
+// 値ごとの各語の場所と、スタックで渡す語数を返す.
+func assignWords(types []*Type, regs []string) ([][]wordLoc, int) {
+	var (
+		locs  = make([][]wordLoc, len(types))
+		nreg  int
+		stack int
+	)
+
+	for i, ty := range types {
+		words := ty.Words()
+
+		// 長さが2以上の配列は、GoのABIInternalと同じく常にスタックで渡す
+		inRegs := nreg+words <= len(regs) && !(ty.Kind == TYArray && ty.Len > 1)
+
+		for k := 0; k < words; k++ {
+			if inRegs {
+				locs[i] = append(locs[i], wordLoc{Reg: regs[nreg+k]})
+			} else {
+				locs[i] = append(locs[i], wordLoc{Stack: stack})
+				stack++
+			}
+		}
+
+		if inRegs {
+			nreg += words
+		}
 	}
 
-	if err := genStmt(node.Left); err != nil {
-		return err
+	return locs, stack
+}
+
+// レジスタで渡す語数.
+func regWords(locs [][]wordLoc) int {
+	var n int
+
+	for _, words := range locs {
+		for _, loc := range words {
+			if loc.Reg != "" {
+				n++
+			}
+		}
 	}
 
-	if err := genStmt(node.Right); err != nil {
-		return err
+	return n
+}
+
+// 関数の引数として受け取る変数と、その各語の場所を返す
+// 戻り値の書き込み先を隠れた引数として受け取る場合、それが最初に並ぶ.
+func paramWords(fn *Node) ([]*Var, [][]wordLoc, int) {
+	var vars []*Var
+
+	if fn.Var != nil && abi.HiddenResult() {
+		vars = append(vars, fn.Var)
 	}
 
-	output.L("  pop rdi")
-	output.L("  pop rax")
+	for p := fn.Params; p != nil; p = p.Next {
+		vars = append(vars, p.Var)
+	}
 
-	switch node.Kind {
-	case NDAdd:
-		output.L("  add rax, rdi")
-	case NDSub:
-		output.L("  sub rax, rdi")
-	case NDMul:
-		output.L("  imul rax, rdi")
-	case NDDiv:
-		output.L("  cqo")
-		output.L("  idiv rdi")
-	case NDEq:
-		output.L("  cmp rax, rdi")
-		output.L("  sete al")
-		output.L("  movzb rax, al")
-	case NDNe:
-		output.L("  cmp rax, rdi")
-		output.L("  setne al")
-		output.L("  movzb rax, al")
-	case NDLt:
-		output.L("  cmp rax, rdi")
-		output.L("  setl al")
-		output.L("  movzb rax, al")
-	case NDLe:
-		output.L("  cmp rax, rdi")
-		output.L("  setle al")
-		output.L("  movzb rax, al")
+	types := make([]*Type, len(vars))
+	for i, v := range vars {
+		types[i] = v.Type
 	}
 
-	output.L("  push rax")
+	locs, nstack := assignWords(types, abi.ArgRegs)
 
-	return nil
+	return vars, locs, nstack
 }
 
-func genLocalValue(node *Node) error {
-	if node.Kind != NDLocalV {
-		return userInput.Err(currentToken.Loc, "変数ではありません")
+// 複数の語からなる戻り値を、要素ごとに分けて返す.
+func resultFields(ty *Type) []*Field {
+	if ty.Kind == TYTuple {
+		return ty.Fields
 	}
 
-	output.L("  mov rax, rbp")
-	output.F("  sub rax, %d\n", node.Offset)
-	output.L("  push rax")
+	return []*Field{{Type: ty}}
+}
 
-	return nil
+// 戻り値をレジスタで返す場合の、各語の場所と、スタックで返す語数.
+func resultWords(ty *Type) ([][]wordLoc, int) {
+	fields := resultFields(ty)
+
+	types := make([]*Type, len(fields))
+	for i, f := range fields {
+		types[i] = f.Type
+	}
+
+	return assignWords(types, abi.ResultRegs)
+}
+
+// 関数呼び出しのコードを生成する
+// 引数を左から順に評価してスタックに積んだ後、
+// 各語をレジスタに移すか、スタックに並べ直して渡す
+// 複数の語からなる引数はアドレスを積んでおき、そこから各語を読む
+// 複数の語からなる戻り値は呼び出し元の一時変数に置き、そのアドレスを積む.
+func genFuncCall(node *Node) error {
+	var types []*Type
+
+	// 戻り値の書き込み先は最初の引数として渡す
+	if node.Var != nil && abi.HiddenResult() {
+		types = append(types, NewPointerType(node.Type))
+	}
+
+	first := len(types)
+
+	for arg := node.Args; arg != nil; arg = arg.Next {
+		if err := genExpr(arg); err != nil {
+			return err
+		}
+
+		// 複数の戻り値は、それぞれを引数として積み直す
+		if arg.Type.Kind == TYTuple {
+			output.L("  pop rax")
+
+			for _, f := range arg.Type.Fields {
+				load(f.Type, "rdi", fmt.Sprintf("rax+%d", f.Offset))
+				output.L("  push rdi")
+				types = append(types, f.Type)
+			}
+
+			continue
+		}
+
+		types = append(types, arg.Type)
+	}
+
+	nargs := len(types) - first
+
+	args, nstack := assignWords(types, abi.ArgRegs)
+
+	var (
+		results  [][]wordLoc
+		nresults int
+	)
+
+	if node.Var != nil && !abi.HiddenResult() {
+		results, nresults = resultWords(node.Type)
+	}
+
+	// 呼び出し先に渡すスタック上の領域は、
+	// 引数、レジスタに収まらない戻り値、レジスタ引数の退避領域の順に並ぶ
+	size := nstack + nresults
+
+	if abi.Spill {
+		size += regWords(args)
+	}
+
+	// baseは評価した引数の先頭を指す
+	// 呼び出し後に戻すため、rspの値を呼び出し先に渡す領域の上に保存しておく
+	base, tmp := abi.Scratch[0], abi.Scratch[1]
+
+	output.F("  mov %s, rsp\n", base)
+	output.F("  sub rsp, %d\n", 8*(size+1))
+	output.L("  and rsp, -16")
+	output.F("  mov [rsp+%d], %s\n", 8*size, base)
+
+	for i := 0; i < nargs; i++ {
+		// i番目の引数の位置
+		src := 8 * (nargs - 1 - i)
+
+		for k, loc := range args[first+i] {
+			reg := loc.Reg
+			if reg == "" {
+				reg = tmp
+			}
+
+			output.F("  mov %s, [%s+%d]\n", reg, base, src)
+
+			if types[first+i].IsAggregate() {
+				output.F("  mov %s, [%s+%d]\n", reg, reg, 8*k)
+			}
+
+			if loc.Reg == "" {
+				output.F("  mov [rsp+%d], %s\n", 8*loc.Stack, tmp)
+			}
+		}
+	}
+
+	if first == 1 {
+		output.F("  lea %s, [rbp-%d]\n", args[0][0].Reg, node.Var.Offset)
+	}
+
+	if abi.ClearAL {
+		output.L("  mov rax, 0")
+	}
+
+	output.F("  call %s\n", funcSymbol(node.Name))
+
+	// レジスタとスタックで返された戻り値を一時変数に移す
+	if results != nil {
+		output.F("  lea %s, [rbp-%d]\n", base, node.Var.Offset)
+
+		for i, f := range resultFields(node.Type) {
+			for k, loc := range results[i] {
+				dst := fmt.Sprintf("%s+%d", base, f.Offset+8*k)
+				reg := loc.Reg
+
+				if reg == "" {
+					reg = tmp
+					output.F("  mov %s, [rsp+%d]\n", tmp, 8*(nstack+loc.Stack))
+				}
+
+				storeWord(dst, reg, f.Type.Size-8*k)
+			}
+		}
+
+		output.F("  mov rax, %s\n", base)
+	}
+
+	output.F("  mov rsp, [rsp+%d]\n", 8*size)
+	output.F("  add rsp, %d\n", 8*nargs)
+	output.L("  push rax")
+
+	return nil
+}
+
+// 複数の語からなる値を返すreturn文のコードを生成する
+// 値が1つの式だけの場合、スタックにはその値のアドレスを積む.
+func genReturnAggregate(node *Node) error {
+	for r := node.Left; r != nil; r = r.Next {
+		if err := genExpr(r); err != nil {
+			return err
+		}
+	}
+
+	if abi.HiddenResult() {
+		genStoreResults(node)
+	} else {
+		genLoadResults(node)
+	}
+
+	output.F("  jmp .L.return.%s\n", funcSymbol(currentFunc.Name))
+
+	return nil
+}
+
+// スタックに積んだ戻り値を、呼び出し元が用意した領域に書き込み、
+// そのアドレスをraxで返す.
+func genStoreResults(node *Node) {
+	ty := currentFunc.Type
+	dst := fmt.Sprintf("rbp-%d", currentFunc.Var.Offset)
+
+	if node.Left.Next == nil {
+		output.F("  mov rax, [%s]\n", dst)
+		output.L("  pop rsi")
+		store(ty, "rax", "rsi")
+	} else {
+		for i := len(ty.Fields) - 1; i >= 0; i-- {
+			f := ty.Fields[i]
+
+			output.L("  pop rsi")
+			output.F("  mov rax, [%s]\n", dst)
+			store(f.Type, fmt.Sprintf("rax+%d", f.Offset), "rsi")
+		}
+	}
+
+	output.F("  mov rax, [%s]\n", dst)
+}
+
+// スタックに積んだ戻り値をレジスタに移す
+// レジスタに収まらないものは、呼び出し元のスタック上の引数の上に書き込む.
+func genLoadResults(node *Node) {
+	base, tmp := abi.Scratch[0], abi.Scratch[1]
+	fields := resultFields(currentFunc.Type)
+	locs, _ := resultWords(currentFunc.Type)
+
+	// スタックで返す戻り値の先頭
+	_, _, nstack := paramWords(currentFunc)
+	stack := 16 + 8*nstack
+
+	// tmpの値を戻り値の1語として置く
+	place := func(loc wordLoc) {
+		if loc.Reg != "" {
+			output.F("  mov %s, %s\n", loc.Reg, tmp)
+		} else {
+			output.F("  mov [rbp+%d], %s\n", stack+8*loc.Stack, tmp)
+		}
+	}
+
+	// baseの指す値からi番目の要素の各語を移す
+	placeField := func(i int, offset int) {
+		f := fields[i]
+
+		if !f.Type.IsAggregate() {
+			load(f.Type, tmp, fmt.Sprintf("%s+%d", base, offset))
+			place(locs[i][0])
+
+			return
+		}
+
+		for k, loc := range locs[i] {
+			output.F("  mov %s, [%s+%d]\n", tmp, base, offset+8*k)
+			place(loc)
+		}
+	}
+
+	if node.Left.Next == nil {
+		output.F("  pop %s\n", base)
+
+		for i, f := range fields {
+			placeField(i, f.Offset)
+		}
+
+		return
+	}
+
+	for i := len(fields) - 1; i >= 0; i-- {
+		if fields[i].Type.IsAggregate() {
+			output.F("  pop %s\n", base)
+			placeField(i, 0)
+
+			continue
+		}
+
+		output.F("  pop %s\n", tmp)
+		place(locs[i][0])
+	}
+}
+
+// switch文のコードを生成する
+// 節の本体は順に並べ、fallthroughで終わらない節の後ろでは末尾へ飛ぶ.
+func genSwitch(node *Node) error {
+	node.Label = uniqueLabel()
+
+	if node.Init != nil {
+		if err := genStmt(node.Init); err != nil {
+			return err
+		}
+	}
+
+	if node.Cond != nil {
+		if err := genExpr(node.Cond); err != nil {
+			return err
+		}
+
+		output.L("  pop rdi")
+		store(node.Var.Type, fmt.Sprintf("rbp-%d", node.Var.Offset), "rdi")
+	}
+
+	// 一致するcaseがなかった場合の飛び先
+	dflt := fmt.Sprintf(".L.end.%s", node.Label)
+
+	var i int
+
+	for clause := node.Body; clause != nil; clause = clause.Next {
+		if clause.Args == nil {
+			dflt = fmt.Sprintf(".L.case.%s.%d", node.Label, i)
+		}
+
+		i++
+	}
+
+	if min, max, ok := jumpTableRange(node); ok {
+		genJumpTable(node, min, max, dflt)
+	} else if err := genCaseChain(node, dflt); err != nil {
+		return err
+	}
+
+	i = 0
+
+	for clause := node.Body; clause != nil; clause = clause.Next {
+		output.F(".L.case.%s.%d:\n", node.Label, i)
+
+		var last *Node
+
+		for body := clause.Body; body != nil; body = body.Next {
+			if err := genStmt(body); err != nil {
+				return err
+			}
+
+			last = body
+		}
+
+		if last == nil || last.Kind != NDFallthrough {
+			output.F("  jmp .L.end.%s\n", node.Label)
+		}
+
+		i++
+	}
+
+	output.F(".L.end.%s:\n", node.Label)
+
+	return nil
+}
+
+// caseの条件式を上から順に評価し、成り立った節へ飛ぶ.
+func genCaseChain(node *Node, dflt string) error {
+	var i int
+
+	for clause := node.Body; clause != nil; clause = clause.Next {
+		for cond := clause.Cond; cond != nil; cond = cond.Next {
+			if err := genExpr(cond); err != nil {
+				return err
+			}
+
+			output.L("  pop rax")
+			output.L("  cmp rax, 0")
+			output.F("  jne .L.case.%s.%d\n", node.Label, i)
+		}
+
+		i++
+	}
+
+	output.F("  jmp %s\n", dflt)
+
+	return nil
+}
+
+// caseの値がすべて整数の定数で、十分な数が密に並んでいれば
+// ジャンプテーブルに載せる値の範囲を返す.
+func jumpTableRange(node *Node) (int, int, bool) {
+	if node.Cond == nil || !node.Cond.Type.IsInteger() {
+		return 0, 0, false
+	}
+
+	var (
+		min int
+		max int
+		n   int
+	)
+
+	for clause := node.Body; clause != nil; clause = clause.Next {
+		for e := clause.Args; e != nil; e = e.Next {
+			if e.Kind != NDNum {
+				return 0, 0, false
+			}
+
+			if n == 0 || e.Val < min {
+				min = e.Val
+			}
+
+			if n == 0 || e.Val > max {
+				max = e.Val
+			}
+
+			n++
+		}
+	}
+
+	// 値の範囲が広すぎるとテーブルの大半が埋まらない
+	span := max - min
+	if n < minJumpTableCases || span < 0 || span >= 2*n {
+		return 0, 0, false
+	}
+
+	return min, max, true
+}
+
+// タグの値でジャンプテーブルを引き、該当する節へ飛ぶ
+// テーブルにはテーブル自身からの相対位置を並べる.
+func genJumpTable(node *Node, min int, max int, dflt string) {
+	targets := make([]string, max-min+1)
+
+	var i int
+
+	for clause := node.Body; clause != nil; clause = clause.Next {
+		for e := clause.Args; e != nil; e = e.Next {
+			targets[e.Val-min] = fmt.Sprintf(".L.case.%s.%d", node.Label, i)
+		}
+
+		i++
+	}
+
+	load(node.Var.Type, "rax", fmt.Sprintf("rbp-%d", node.Var.Offset))
+	output.F("  mov rdi, %d\n", min)
+	output.L("  sub rax, rdi")
+	output.F("  cmp rax, %d\n", max-min)
+	output.F("  ja  %s\n", dflt)
+	output.F("  lea rdi, [rip+.L.table.%s]\n", node.Label)
+	output.L("  movsxd rax, dword ptr [rdi+rax*4]")
+	output.L("  add rax, rdi")
+	output.L("  jmp rax")
+
+	output.L("  .section .rodata")
+	output.L("  .align 4")
+	output.F(".L.table.%s:\n", node.Label)
+
+	for _, target := range targets {
+		if target == "" {
+			target = dflt
+		}
+
+		output.F("  .long %s-.L.table.%s\n", target, node.Label)
+	}
+
+	output.L("  .text")
+}
+
+// 式のコードを生成する
+// 式の値をスタックに1つ積む.
+func genExpr(node *Node) error {
+	switch node.Kind {
+	case NDNum:
+		// pushの即値は32ビットまで
+		if node.Val != int(int32(node.Val)) {
+			output.F("  mov rax, %d\n", node.Val)
+			output.L("  push rax")
+
+			return nil
+		}
+
+		output.F("  push %d\n", node.Val)
+
+		return nil
+	case NDLocalV, NDGlobalV:
+		if err := genAddr(node); err != nil {
+			return err
+		}
+
+		output.L("  pop rax")
+		load(node.Type, "rax", "rax")
+		output.L("  push rax")
+
+		return nil
+	case NDStr:
+		// 文字列の先頭アドレスと長さを一時変数に組み立てる
+		node.Label = uniqueLabel()
+		stringLiterals = append(stringLiterals, node)
+
+		output.F("  lea rax, [rip+.L.str.%s]\n", node.Label)
+		output.F("  mov [rbp-%d], rax\n", node.Var.Offset)
+		output.F("  mov qword ptr [rbp-%d], %d\n", node.Var.Offset-8, len(node.Tok.Contents))
+		output.F("  lea rax, [rbp-%d]\n", node.Var.Offset)
+		output.L("  push rax")
+
+		return nil
+	case NDIndex:
+		if err := genElemAddr(node); err != nil {
+			return err
+		}
+
+		output.L("  pop rax")
+		load(node.Type, "rax", "rax")
+		output.L("  push rax")
+
+		return nil
+	case NDMember:
+		if err := genMemberAddr(node); err != nil {
+			return err
+		}
+
+		output.L("  pop rax")
+		load(node.Type, "rax", "rax")
+		output.L("  push rax")
+
+		return nil
+	case NDLen:
+		if err := genExpr(node.Left); err != nil {
+			return err
+		}
+
+		output.L("  pop rax")
+
+		if ty := node.Left.Type; ty.Kind == TYArray {
+			output.F("  push %d\n", ty.Len)
+		} else {
+			output.L("  push [rax+8]")
+		}
+
+		return nil
+	case NDCap:
+		if err := genExpr(node.Left); err != nil {
+			return err
+		}
+
+		output.L("  pop rax")
+
+		if ty := node.Left.Type; ty.Kind == TYArray {
+			output.F("  push %d\n", ty.Len)
+		} else {
+			output.L("  push [rax+16]")
+		}
+
+		return nil
+	case NDNil:
+		// スライスのnilは要素を指さない長さ0のスライス
+		if node.Type.IsAggregate() {
+			output.F("  lea rax, [rbp-%d]\n", node.Var.Offset)
+			zero(node.Type, "rax")
+			output.F("  lea rax, [rbp-%d]\n", node.Var.Offset)
+		} else {
+			output.L("  mov rax, 0")
+		}
+
+		output.L("  push rax")
+
+		return nil
+	case NDCompLit:
+		return genCompositeLit(node)
+	case NDSlice:
+		return genSliceExpr(node)
+	case NDMake:
+		return genMake(node)
+	case NDAppend:
+		return genAppend(node)
+	case NDSliceCopy:
+		return genSliceCopy(node)
+	case NDCopy:
+		if err := genExpr(node.Left); err != nil {
+			return err
+		}
+
+		output.L("  pop rax")
+		store(node.Type, fmt.Sprintf("rbp-%d", node.Var.Offset), "rax")
+		output.F("  lea rax, [rbp-%d]\n", node.Var.Offset)
+		output.L("  push rax")
+
+		return nil
+	case NDConv:
+		if err := genExpr(node.Left); err != nil {
+			return err
+		}
+
+		// 小さい型への変換では上位のビットを捨てる
+		if !node.Type.IsAggregate() {
+			output.L("  pop rax")
+			extend(node.Type, "rax")
+			output.L("  push rax")
+		}
+
+		return nil
+	case NDFuncCall:
+		return genFuncCall(node)
+	case NDAddress:
+		if node.Left.Kind == NDCompLit {
+			return genCompositeLitAddr(node.Left)
+		}
+
+		if err := genAddr(node.Left); err != nil {
+			return err
+		}
+
+		return nil
+	case NDDereference:
+		if err := genExpr(node.Left); err != nil {
+			return err
+		}
+
+		output.L("  pop rax")
+		load(node.Type, "rax", "rax")
+		output.L("  push rax")
+
+		return nil
+	case NDNot:
+		if err := genExpr(node.Left); err != nil {
+			return err
+		}
+
+		output.L("  pop rax")
+		output.L("  cmp rax, 0")
+		output.L("  sete al")
+		output.L("  movzb rax, al")
+		output.L("  push rax")
+
+		return nil
+	case NDBitNot:
+		if err := genExpr(node.Left); err != nil {
+			return err
+		}
+
+		output.L("  pop rax")
+		output.L("  not rax")
+		extend(node.Type, "rax")
+		output.L("  push rax")
+
+		return nil
+	case NDLogAnd, NDLogOr:
+		return genLogical(node)
+	}
+
+	if err := genExpr(node.Left); err != nil {
+		return err
+	}
+
+	if err := genExpr(node.Right); err != nil {
+		return err
+	}
+
+	if node.Left.Type.Kind == TYString {
+		genStringOp(node)
+
+		return nil
+	}
+
+	output.L("  pop rdi")
+	output.L("  pop rax")
+
+	// スライスはnilとだけ比較するので、要素の先頭アドレスを比べる
+	if node.Left.Type.Kind == TYSlice {
+		output.L("  mov rdi, [rdi]")
+		output.L("  mov rax, [rax]")
+	}
+
+	switch node.Kind {
+	case NDAdd:
+		output.L("  add rax, rdi")
+	case NDSub:
+		output.L("  sub rax, rdi")
+	case NDMul:
+		output.L("  imul rax, rdi")
+	case NDDiv:
+		output.L("  cqo")
+		output.L("  idiv rdi")
+	case NDMod:
+		output.L("  cqo")
+		output.L("  idiv rdi")
+		output.L("  mov rax, rdx")
+	case NDBitAnd:
+		output.L("  and rax, rdi")
+	case NDBitOr:
+		output.L("  or rax, rdi")
+	case NDBitXor:
+		output.L("  xor rax, rdi")
+	case NDAndNot:
+		output.L("  not rdi")
+		output.L("  and rax, rdi")
+	case NDShl:
+		// 64ビット以上のシフトは0になる
+		output.L("  mov rcx, rdi")
+		output.L("  shl rax, cl")
+		output.L("  xor rdx, rdx")
+		output.L("  cmp rdi, 64")
+		output.L("  cmovae rax, rdx")
+	case NDShr:
+		// 64ビット以上のシフトは63ビットのシフトと同じ結果になる
+		output.L("  mov rcx, 63")
+		output.L("  cmp rdi, 63")
+		output.L("  cmovbe rcx, rdi")
+		output.L("  sar rax, cl")
+	case NDEq:
+		output.L("  cmp rax, rdi")
+		output.L("  sete al")
+		output.L("  movzb rax, al")
+	case NDNe:
+		output.L("  cmp rax, rdi")
+		output.L("  setne al")
+		output.L("  movzb rax, al")
+	case NDLt:
+		output.L("  cmp rax, rdi")
+		output.L("  setl al")
+		output.L("  movzb rax, al")
+	case NDLe:
+		output.L("  cmp rax, rdi")
+		output.L("  setle al")
+		output.L("  movzb rax, al")
+	}
+
+	// 1語より小さい型の演算結果はその型の範囲に収める
+	extend(node.Type, "rax")
+	output.L("  push rax")
+
+	return nil
+}
+
+// セレクタ式のフィールドのアドレスをスタックに積む
+// 構造体の値も構造体へのポインタも、評価すると構造体のアドレスになる.
+func genMemberAddr(node *Node) error {
+	if err := genExpr(node.Left); err != nil {
+		return err
+	}
+
+	if offset := selectedField(node).Offset; offset != 0 {
+		output.L("  pop rax")
+		output.F("  add rax, %d\n", offset)
+		output.L("  push rax")
+	}
+
+	return nil
+}
+
+// 添字式の要素のアドレスをスタックに積む
+// 添字が範囲外であれば実行時パニックにする.
+func genElemAddr(node *Node) error {
+	if err := genExpr(node.Left); err != nil {
+		return err
+	}
+
+	if err := genExpr(node.Right); err != nil {
+		return err
+	}
+
+	output.L("  pop rdi")
+	output.L("  pop rax")
+
+	if kind := node.Left.Type.Kind; kind == TYString || kind == TYSlice {
+		output.L("  cmp rdi, [rax+8]")
+		output.L("  jae went.panicIndex")
+		output.L("  mov rax, [rax]")
+	} else {
+		output.F("  cmp rdi, %d\n", indexedArray(node).Len)
+		output.L("  jae went.panicIndex")
+	}
+
+	if size := node.Type.Size; size != 1 {
+		output.F("  imul rdi, %d\n", size)
+	}
+
+	output.L("  add rax, rdi")
+	output.L("  push rax")
+
+	return nil
+}
+
+// 複合リテラルの値を一時変数に組み立て、そのアドレスを積む
+// 省略された要素はゼロ値になる.
+func genCompositeLit(node *Node) error {
+	ty := node.Type
+	offset := node.Var.Offset
+
+	if ty.Kind == TYSlice {
+		return genSliceLit(node)
+	}
+
+	output.F("  lea rax, [rbp-%d]\n", offset)
+	zero(ty, "rax")
+
+	if ty.Kind == TYStruct {
+		for i, elem := 0, node.Args; elem != nil; i, elem = i+1, elem.Next {
+			f, val := ty.Fields[i], elem
+
+			if elem.Kind == NDKeyVal {
+				f, val = ty.FindField(elem.Name), elem.Left
+			}
+
+			if err := genExpr(val); err != nil {
+				return err
+			}
+
+			output.L("  pop rax")
+			store(f.Type, fmt.Sprintf("rbp-%d", offset-f.Offset), "rax")
+		}
+
+		output.F("  lea rax, [rbp-%d]\n", offset)
+		output.L("  push rax")
+
+		return nil
+	}
+
+	for elem := node.Args; elem != nil; elem = elem.Next {
+		if err := genExpr(elem); err != nil {
+			return err
+		}
+
+		output.L("  pop rax")
+		store(ty.Base, fmt.Sprintf("rbp-%d", offset), "rax")
+
+		offset -= ty.Base.Size
+	}
+
+	output.F("  lea rax, [rbp-%d]\n", node.Var.Offset)
+	output.L("  push rax")
+
+	return nil
+}
+
+// スライスのリテラルのコードを生成する
+// 要素の数と同じ長さと容量の配列を確保し、そこに要素を書き込む.
+func genSliceLit(node *Node) error {
+	ty := node.Type
+	n := listLen(node.Args)
+
+	output.F("  lea rdi, [rbp-%d]\n", node.Var.Offset)
+	output.F("  mov rsi, %d\n", ty.Base.Size)
+	output.F("  mov rdx, %d\n", n)
+	output.F("  mov rcx, %d\n", n)
+	genRuntimeCall("went.makeslice")
+
+	var offset int
+
+	for elem := node.Args; elem != nil; elem = elem.Next {
+		if err := genExpr(elem); err != nil {
+			return err
+		}
+
+		output.L("  pop rax")
+		output.F("  mov rdx, [rbp-%d]\n", node.Var.Offset)
+		store(ty.Base, fmt.Sprintf("rdx+%d", offset), "rax")
+
+		offset += ty.Base.Size
+	}
+
+	output.F("  lea rax, [rbp-%d]\n", node.Var.Offset)
+	output.L("  push rax")
+
+	return nil
+}
+
+// スライス式のコードを生成する
+// 対象の先頭アドレス、長さ、容量をr8, r9, r10に求め、
+// 0 <= lo <= hi <= max <= capであることを確かめてから結果を組み立てる.
+func genSliceExpr(node *Node) error {
+	if err := genExpr(node.Left); err != nil {
+		return err
+	}
+
+	indices := []*Node{node.Low, node.High, node.Max}
+
+	for _, index := range indices {
+		if index != nil {
+			if err := genExpr(index); err != nil {
+				return err
+			}
+		}
+	}
+
+	regs := []string{"rdi", "rsi", "rdx"}
+
+	for i := len(indices) - 1; i >= 0; i-- {
+		if indices[i] != nil {
+			output.F("  pop %s\n", regs[i])
+		}
+	}
+
+	output.L("  pop rax")
+
+	ty := node.Left.Type
+	elemSize := 1
+
+	switch ty.Kind {
+	case TYString:
+		output.L("  mov r8, [rax]")
+		output.L("  mov r9, [rax+8]")
+		output.L("  mov r10, r9")
+	case TYSlice:
+		elemSize = ty.Base.Size
+
+		output.L("  mov r8, [rax]")
+		output.L("  mov r9, [rax+8]")
+		output.L("  mov r10, [rax+16]")
+	default:
+		ty = indexedArray(node)
+		elemSize = ty.Base.Size
+
+		output.L("  mov r8, rax")
+		output.F("  mov r9, %d\n", ty.Len)
+		output.F("  mov r10, %d\n", ty.Len)
+	}
+
+	// 省略された添字の既定値
+	defaults := []string{"0", "r9", "r10"}
+
+	for i, index := range indices {
+		if index == nil {
+			output.F("  mov %s, %s\n", regs[i], defaults[i])
+		}
+	}
+
+	output.L("  cmp rdx, r10")
+	output.L("  ja  went.panicSlice")
+	output.L("  cmp rsi, rdx")
+	output.L("  ja  went.panicSlice")
+	output.L("  cmp rdi, rsi")
+	output.L("  ja  went.panicSlice")
+
+	output.L("  mov rax, rdi")
+	output.F("  imul rax, %d\n", elemSize)
+	output.L("  add r8, rax")
+	output.L("  sub rsi, rdi")
+	output.L("  sub rdx, rdi")
+
+	offset := node.Var.Offset
+
+	output.F("  mov [rbp-%d], r8\n", offset)
+	output.F("  mov [rbp-%d], rsi\n", offset-8)
+
+	if node.Type.Kind == TYSlice {
+		output.F("  mov [rbp-%d], rdx\n", offset-16)
+	}
+
+	output.F("  lea rax, [rbp-%d]\n", offset)
+	output.L("  push rax")
+
+	return nil
+}
+
+// make([]T, len, cap)のコードを生成する
+// 容量が省略された場合は長さと同じにする.
+func genMake(node *Node) error {
+	for arg := node.Args; arg != nil; arg = arg.Next {
+		if err := genExpr(arg); err != nil {
+			return err
+		}
+	}
+
+	if node.Args.Next == nil {
+		output.L("  push [rsp]")
+	}
+
+	output.L("  pop rcx")
+	output.L("  pop rdx")
+	output.F("  lea rdi, [rbp-%d]\n", node.Var.Offset)
+	output.F("  mov rsi, %d\n", node.Type.Base.Size)
+	genRuntimeCall("went.makeslice")
+	output.F("  lea rax, [rbp-%d]\n", node.Var.Offset)
+	output.L("  push rax")
+
+	return nil
+}
+
+// appendのコードを生成する
+// 追加する値を先に評価してから、元のスライスを一時変数に移し、
+// 容量が足りなければ配列を確保し直して末尾に書き込む.
+func genAppend(node *Node) error {
+	ty := node.Type
+	size := ty.Base.Size
+	hdr := node.Var.Offset
+
+	var n int
+
+	for x := node.Args.Next; x != nil; x = x.Next {
+		if err := genExpr(x); err != nil {
+			return err
+		}
+
+		n++
+	}
+
+	if err := genExpr(node.Args); err != nil {
+		return err
+	}
+
+	output.L("  pop rax")
+	store(ty, fmt.Sprintf("rbp-%d", hdr), "rax")
+
+	if node.Ellipsis {
+		output.L("  mov rax, [rsp]")
+		output.L("  mov rdx, [rax+8]")
+	} else {
+		output.F("  mov rdx, %d\n", n)
+	}
+
+	output.F("  lea rdi, [rbp-%d]\n", hdr)
+	output.F("  mov rsi, %d\n", size)
+	genRuntimeCall("went.growslice")
+
+	// 元のスライスの末尾に、複製元の要素をまとめて移す
+	if node.Ellipsis {
+		output.L("  pop rax")
+		output.L("  mov rdx, [rax+8]")
+		output.L("  mov rsi, [rax]")
+		output.F("  mov rax, [rbp-%d]\n", hdr-8)
+		output.L("  mov rdi, rax")
+		output.F("  imul rdi, %d\n", size)
+		output.F("  add rdi, [rbp-%d]\n", hdr)
+		output.L("  add rax, rdx")
+		output.F("  mov [rbp-%d], rax\n", hdr-8)
+		output.F("  imul rdx, %d\n", size)
+		genRuntimeCall("memmove@PLT")
+	} else {
+		for i := n - 1; i >= 0; i-- {
+			output.L("  pop rax")
+			output.F("  mov rdx, [rbp-%d]\n", hdr-8)
+			output.F("  imul rdx, %d\n", size)
+			output.F("  add rdx, [rbp-%d]\n", hdr)
+			store(ty.Base, fmt.Sprintf("rdx+%d", i*size), "rax")
+		}
+
+		output.F("  add qword ptr [rbp-%d], %d\n", hdr-8, n)
+	}
+
+	output.F("  lea rax, [rbp-%d]\n", hdr)
+	output.L("  push rax")
+
+	return nil
+}
+
+// copy(dst, src)のコードを生成する
+// 重なりのある領域の間でも正しく複製し、複製した要素の数を積む.
+func genSliceCopy(node *Node) error {
+	dst, src := node.Args, node.Args.Next
+
+	if err := genExpr(dst); err != nil {
+		return err
+	}
+
+	if err := genExpr(src); err != nil {
+		return err
+	}
+
+	output.L("  pop rsi")
+	output.L("  pop rdi")
+	output.L("  mov rdx, [rdi+8]")
+	output.L("  mov rcx, [rsi+8]")
+	output.L("  cmp rcx, rdx")
+	output.L("  cmovb rdx, rcx")
+	output.L("  push rdx")
+	output.F("  imul rdx, %d\n", dst.Type.Base.Size)
+	output.L("  mov rdi, [rdi]")
+	output.L("  mov rsi, [rsi]")
+	genRuntimeCall("memmove@PLT")
+
+	return nil
+}
+
+// 文字列の連結と比較のコードを生成する
+// 比較は実行時ライブラリで-1, 0, 1のいずれかを求めてから0と比べる.
+func genStringOp(node *Node) {
+	output.L("  pop rsi")
+	output.L("  pop rdi")
+
+	if node.Kind == NDAdd {
+		output.L("  mov rdx, rsi")
+		output.L("  mov rsi, rdi")
+		output.F("  lea rdi, [rbp-%d]\n", node.Var.Offset)
+		genRuntimeCall("went.concatstring")
+		output.L("  push rax")
+
+		return
+	}
+
+	genRuntimeCall("went.cmpstring")
+
+	set := map[NodeKind]string{NDEq: "sete", NDNe: "setne", NDLt: "setl", NDLe: "setle"}
+
+	output.L("  cmp rax, 0")
+	output.F("  %s al\n", set[node.Kind])
+	output.L("  movzb rax, al")
+	output.L("  push rax")
+}
+
+// rdi, rsi, rdxに引数を置いた状態で、実行時ライブラリの関数を呼び出す
+// 呼び出し時のrspを16バイト境界に揃え、元のrspを呼び出し先の上に保存しておく.
+func genRuntimeCall(name string) {
+	output.L("  mov rax, rsp")
+	output.L("  sub rsp, 8")
+	output.L("  and rsp, -16")
+	output.L("  mov [rsp], rax")
+	output.F("  call %s\n", name)
+	output.L("  mov rsp, [rsp]")
+}
+
+// メモリ上のaddrにあるty型の値をレジスタdstに読み込む
+// 複数の語からなる型では、値の代わりにそのアドレスを読み込む.
+func load(ty *Type, dst string, addr string) {
+	switch {
+	case ty.IsAggregate():
+		output.F("  lea %s, [%s]\n", dst, addr)
+	case ty.Size == 1:
+		output.F("  movzx %s, byte ptr [%s]\n", dst, addr)
+	case ty.Size == 4:
+		output.F("  movsxd %s, dword ptr [%s]\n", dst, addr)
+	default:
+		output.F("  mov %s, [%s]\n", dst, addr)
+	}
+}
+
+// レジスタsrcにあるty型の値をメモリ上のaddrに書き込む
+// 複数の語からなる型では、srcの指す値を複製する
+// その場合、rcx, rsi, rdiを書き換える.
+func store(ty *Type, addr string, src string) {
+	if ty.IsAggregate() {
+		output.F("  push %s\n", src)
+		output.F("  lea rdi, [%s]\n", addr)
+		output.L("  pop rsi")
+		output.F("  mov rcx, %d\n", ty.Size)
+		output.L("  rep movsb")
+
+		return
+	}
+
+	output.F("  mov %s ptr [%s], %s\n", ptrSize(ty.Size), addr, regName(src, ty.Size))
+}
+
+// レジスタregの下位sizeバイトをaddrに書き込む
+// 8バイト以上であれば1語をすべて書き込み、端数であればregを書き換える.
+func storeWord(addr string, reg string, size int) {
+	if size >= 8 {
+		output.F("  mov [%s], %s\n", addr, reg)
+
+		return
+	}
+
+	for i := 0; i < size; i++ {
+		output.F("  mov byte ptr [%s+%d], %s\n", addr, i, regName(reg, 1))
+		output.F("  shr %s, 8\n", reg)
+	}
+}
+
+// メモリ上のaddrにあるty型の値をゼロ値にする
+// 複数の語からなる型では、rax, rcx, rdiを書き換える.
+func zero(ty *Type, addr string) {
+	if ty.IsAggregate() {
+		output.F("  lea rdi, [%s]\n", addr)
+		output.F("  mov rcx, %d\n", ty.Size)
+		output.L("  xor eax, eax")
+		output.L("  rep stosb")
+
+		return
+	}
+
+	output.F("  mov %s ptr [%s], 0\n", ptrSize(ty.Size), addr)
+}
+
+// 1語より小さい型の値を、レジスタ全体に符号拡張またはゼロ拡張する.
+func extend(ty *Type, reg string) {
+	switch ty.Size {
+	case 1:
+		output.F("  movzx %s, %s\n", reg, regName(reg, 1))
+	case 4:
+		output.F("  movsxd %s, %s\n", reg, regName(reg, 4))
+	}
+}
+
+// メモリのオペランドの大きさの指定.
+func ptrSize(size int) string {
+	switch size {
+	case 1:
+		return "byte"
+	case 4:
+		return "dword"
+	}
+
+	return "qword"
+}
+
+// 64ビットのレジスタの下位sizeバイトを指す名前.
+func regName(reg string, size int) string {
+	// r8からr15
+	numbered := '0' <= reg[1] && reg[1] <= '9'
+
+	switch size {
+	case 1:
+		if numbered {
+			return reg + "b"
+		}
+
+		if reg == "rsi" || reg == "rdi" {
+			return reg[1:] + "l"
+		}
+
+		return reg[1:2] + "l"
+	case 4:
+		if numbered {
+			return reg + "d"
+		}
+
+		return "e" + reg[1:]
+	}
+
+	return reg
+}
+
+// &&, ||のコードを生成する
+// 左辺だけで結果が決まる場合、右辺は評価しない.
+func genLogical(node *Node) error {
+	label := uniqueLabel()
+
+	// 左辺がこの値であれば右辺を評価せずに結果が決まる
+	short := 0
+	if node.Kind == NDLogOr {
+		short = 1
+	}
+
+	for _, operand := range []*Node{node.Left, node.Right} {
+		if err := genExpr(operand); err != nil {
+			return err
+		}
+
+		output.L("  pop rax")
+		output.F("  cmp rax, %d\n", short)
+		output.F("  je  .L.short.%s\n", label)
+	}
+
+	output.F("  push %d\n", 1-short)
+	output.F("  jmp .L.end.%s\n", label)
+	output.F(".L.short.%s:\n", label)
+	output.F("  push %d\n", short)
+	output.F(".L.end.%s:\n", label)
+
+	return nil
+}
+
+// &T{...}
+// 複合リテラルの値を新しく確保した領域に複製し、そのアドレスをスタックに積む
+// 関数から返しても、ループの中で何度評価しても、別々の変数を指す.
+func genCompositeLitAddr(node *Node) error {
+	if err := genCompositeLit(node); err != nil {
+		return err
+	}
+
+	output.L("  mov rdi, 1")
+	output.F("  mov rsi, %d\n", node.Type.Size)
+	genRuntimeCall("calloc@PLT")
+	output.L("  pop rsi")
+	output.L("  mov rdi, rax")
+	output.F("  mov rcx, %d\n", node.Type.Size)
+	output.L("  rep movsb")
+	output.L("  push rax")
+
+	return nil
+}
+
+// 左辺値のアドレスをスタックに積む.
+func genAddr(node *Node) error {
+	switch node.Kind {
+	case NDLocalV:
+		output.L("  mov rax, rbp")
+		output.F("  sub rax, %d\n", node.Var.Offset)
+		output.L("  push rax")
+
+		return nil
+	case NDGlobalV:
+		output.F("  lea rax, [rip+%s]\n", varSymbol(node.Var))
+		output.L("  push rax")
+
+		return nil
+	case NDDereference:
+		return genExpr(node.Left)
+	case NDIndex:
+		return genElemAddr(node)
+	case NDMember:
+		return genMemberAddr(node)
+	}
+
+	return node.Tok.Err("左辺値ではありません")
+}
+
+// ローカル変数のスタック上の位置を決め、関数のフレームサイズを求める
+// アドレスを取られる変数は、スコープを抜けた後もポインタから参照されうるので、
+// 他の変数と領域を使い回さないように先に配置する.
+func layoutFunction(fn *Node) {
+	offset := layoutAddressed(fn, 0)
+	fn.Size = alignTo(layoutScope(fn, offset), 16)
+}
+
+// ノードと内側のスコープで宣言された、アドレスを取られる変数をoffsetより下に配置し、
+// 使用する領域の大きさを返す.
+func layoutAddressed(node *Node, offset int) int {
+	if node == nil {
+		return offset
+	}
+
+	for v := node.Locals; v != nil; v = v.Next {
+		if v.Const == nil && v.Addressed {
+			offset = alignTo(offset+v.Type.Size, v.Type.Align)
+			v.Offset = offset
+		}
+	}
+
+	for _, child := range scopeChildren(node) {
+		offset = layoutAddressed(child, offset)
+	}
+
+	return offset
+}
+
+// ノードのスコープで宣言された変数をoffsetより下に配置し、
+// 内側のスコープも含めて使用する領域の大きさを返す
+// 兄弟関係にあるスコープは同じ領域を使い回す.
+func layoutScope(node *Node, offset int) int {
+	if node == nil {
+		return offset
+	}
+
+	for v := node.Locals; v != nil; v = v.Next {
+		// 定数は領域を持たず、アドレスを取られる変数は配置済み
+		if v.Const != nil || v.Addressed {
+			continue
+		}
+
+		offset = alignTo(offset+v.Type.Size, v.Type.Align)
+		v.Offset = offset
+	}
+
+	size := offset
+
+	for _, child := range scopeChildren(node) {
+		if s := layoutScope(child, offset); s > size {
+			size = s
+		}
+	}
+
+	return size
+}
+
+// 内側のスコープを持ちうるノードの子を返す.
+func scopeChildren(node *Node) []*Node {
+	children := []*Node{node.Init, node.Then, node.Else, node.Inc}
+	for body := node.Body; body != nil; body = body.Next {
+		children = append(children, body)
+	}
+
+	return children
+}
+
+func alignTo(n int, align int) int {
+	return (n + align - 1) / align * align
 }
 
 func uniqueLabel() string {
@@ -1,12 +1,18 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 )
 
 const (
-	numberOfArgs = 2
+	minNumberOfArgs = 1
+	stdinFileName   = "-"
+	stdinInputName  = "<stdin>"
+	sourceFileExt   = ".go"
 )
 
 // 現在着目しているトークン.
@@ -16,19 +22,56 @@ func proceedToken() {
 	currentToken = currentToken.Next
 }
 
-// ユーザーの入力文字列を保持する.
-var userInput UserInput
-
 // ニーモニックのラベル名を管理する.
 var label int
 
-// local変数保存用
+// 現在のスコープ
 // 関数ごとに初期化される.
-var localValue *Node
+var scope *Scope
 
 // 出力先
 var output *Writer
 
+// break, continueの対象になる文
+// 内側にあるものほど後ろに並ぶ.
+var breakTargets []*Node
+
+// 関数内で定義されたラベルと、使われたラベル.
+var (
+	labels     map[string]*Token
+	usedLabels map[string]bool
+)
+
+// 宣言された型名と、その型宣言.
+var typeDecls = map[string]*TypeDecl{}
+
+// 長さを式で書いた配列型と、それを要素に含むために大きさが決まっていない型
+// 作られた順に並び、型検査で長さを求めてから大きさを決める.
+var pendingTypes []*Type
+
+// パッケージレベルで宣言された変数と定数.
+var globalVars = map[string]*Var{}
+
+// if, for, switchのヘッダを読んでいる
+// ヘッダでは型名に続く{を複合リテラルではなくブロックの始まりとみなす
+// 括弧の内側ではこの限りではない.
+var noCompositeLit bool
+
+// 定数宣言の値の式でiotaが表す値
+// 定数宣言の外では-1.
+var iotaValue = -1
+
+// 構文解析中の関数の名前付きの戻り値
+// 戻り値に名前がなければ空.
+var namedResults []*Var
+
+// コード生成中に現れた文字列リテラル
+// 内容は最後にまとめて出力する.
+var stringLiterals []*Node
+
+// 見つかったエラーを溜めておく.
+var errorList ErrorList
+
 func main() {
 	if err := run(); err != nil {
 		fmt.Fprintln(os.Stderr, err)
@@ -39,31 +82,88 @@ func main() {
 }
 
 func run() error {
-	if len(os.Args) != numberOfArgs {
+	flags := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	flags.IntVar(&errorLimit, "errlimit", defaultErrorLimit, "maximum number of errors to report (0 means no limit)")
+	abiName := flags.String("abi", "c", "calling convention of generated functions (c or internal)")
+
+	if err := flags.Parse(os.Args[1:]); err != nil {
+		return err
+	}
+
+	var err error
+	if abi, err = lookupABI(*abiName); err != nil {
+		return err
+	}
+
+	if flags.NArg() < minNumberOfArgs {
 		return ErrIncorrectNumberArgument
 	}
 
 	output = NewWriter(os.Stdout)
 
-	p := os.Args[1]
-
-	userInput = UserInput(p)
+	inputs, err := readInputs(flags.Args())
+	if err != nil {
+		return err
+	}
 
-	token, err := tokenize(p)
+	token, err := tokenize(inputs)
 	if err != nil {
 		return err
 	}
 
 	currentToken = token
 
-	node, err := parse()
+	node, err := parse(inputs)
 	if err != nil {
 		return err
 	}
 
+	if err := check(node); err != nil {
+		return err
+	}
+
 	if err := generate(node); err != nil {
 		return err
 	}
 
 	return nil
 }
+
+// 引数で指定されたソースファイルを読み込む
+// "-"の場合は標準入力から読み込む.
+func readInputs(names []string) ([]*UserInput, error) {
+	inputs := make([]*UserInput, 0, len(names))
+
+	for _, name := range names {
+		input, err := readInput(name)
+		if err != nil {
+			return nil, err
+		}
+
+		inputs = append(inputs, input)
+	}
+
+	return inputs, nil
+}
+
+func readInput(name string) (*UserInput, error) {
+	if name == stdinFileName {
+		src, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, err
+		}
+
+		return NewUserInput(stdinInputName, string(src)), nil
+	}
+
+	if filepath.Ext(name) != sourceFileExt {
+		return nil, fmt.Errorf("%s: %w", name, ErrNotGoFile)
+	}
+
+	src, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewUserInput(name, string(src)), nil
+}
@@ -1,6 +1,6 @@
 package main
 
-const offsetSize = 8
+import "math/big"
 
 type NodeKind int
 
@@ -10,12 +10,23 @@ const (
 	NDSub                  // -
 	NDMul                  // *
 	NDDiv                  // /
+	NDMod                  // %
+	NDBitAnd               // &
+	NDBitOr                // |
+	NDBitXor               // ^
+	NDAndNot               // &^
+	NDShl                  // <<
+	NDShr                  // >>
+	NDLogAnd               // &&
+	NDLogOr                // ||
+	NDNot                  // 単項の!
+	NDBitNot               // 単項の^
 	NDEq                   // ==
 	NDNe                   // !=
 	NDLt                   // <
 	NDLe                   // <=
 	NDNum                  // 123
-	NDAssign               // =
+	NDAssign               // = 左辺と右辺はそれぞれNextで繋がる
 	NDLocalV               // ローカル変数
 	NDReturn               // return
 	NDIf                   // if
@@ -25,6 +36,29 @@ const (
 	NDFuncDef              // 関数定義
 	NDAddress              // *
 	NDDereference          // &
+	NDVarDecl              // 変数宣言 左辺と右辺はそれぞれNextで繋がる
+	NDBreak                // break
+	NDContinue             // continue
+	NDSwitch               // switch
+	NDCase                 // case, default
+	NDFallthrough          // fallthrough
+	NDBlank                // _
+	NDStr                  // 文字列リテラル
+	NDIndex                // a[i]
+	NDLen                  // len(a)
+	NDCopy                 // 値を一時変数に複製する
+	NDConv                 // 型変換 T(x)
+	NDCompLit              // 複合リテラル 要素はArgsにNextで繋がる
+	NDSlice                // a[lo:hi:max]
+	NDCap                  // cap(a)
+	NDMake                 // make(T, len, cap)
+	NDAppend               // append(s, x...)
+	NDSliceCopy            // copy(dst, src)
+	NDMember               // x.f
+	NDKeyVal               // 複合リテラルの要素 f: x
+	NDGlobalV              // パッケージレベルの変数、定数
+	NDConstDecl            // 定数宣言 左辺と右辺はそれぞれNextで繋がる
+	NDNil                  // nil
 )
 
 type Node struct {
@@ -40,31 +74,91 @@ type Node struct {
 	Next   *Node
 	Args   *Node
 	Params *Node
-	Locals *Node
-	Root   *Node
+	Locals *Var // このノードのスコープで宣言された変数
+	Var    *Var
 	Val    int
-	Offset int
-	Name   []rune
+	Const  *big.Int // 定数式の値、型のない定数は任意の精度で持つ
+	Name   []rune   // 関数名、ラベル名、フィールド名
 	Size   int
+
+	// スライス式の添字
+	// 省略されたものはnil
+	Low  *Node
+	High *Node
+	Max  *Node
+
+	// 関数呼び出しの最後の引数に...が付いている
+	Ellipsis bool
+
+	// break, continueの対象の文
+	Target *Node
+
+	// コード生成時に割り当てるラベル
+	Label string
+
+	// 式の型
+	// 関数定義の場合は戻り値の型
+	Type *Type
+
+	// エラー報告に使うトークン
+	Tok *Token
+}
+
+// ローカル変数、パッケージレベルの変数と定数.
+type Var struct {
+	Name   []rune
+	Type   *Type
+	Offset int
+	Next   *Var // 同じスコープで宣言された変数
+
+	// パッケージレベルの変数や定数、ローカルな定数を宣言したノード
+	// ローカル変数ではnil
+	Decl *Node
+
+	// 定数の値を表すリテラル
+	// 定数でなければnil
+	Const *Node
+
+	// アドレスを取られるローカル変数であれば真
+	Addressed bool
+}
+
+// 変数のスコープ
+// ブロックごとに作られる.
+type Scope struct {
+	Vars *Var
+	Up   *Scope
 }
 
-func NewNode(kind NodeKind, left *Node, right *Node) *Node {
+func NewNode(kind NodeKind, left *Node, right *Node, tok *Token) *Node {
 	return &Node{
 		Kind:  kind,
 		Left:  left,
 		Right: right,
+		Tok:   tok,
 	}
 }
 
-func NewNodeNum(val int) *Node {
-	node := NewNode(NDNum, nil, nil)
+func NewNodeNum(val int, tok *Token) *Node {
+	node := NewNode(NDNum, nil, nil, tok)
 	node.Val = val
 
 	return node
 }
 
-func NewNodeIf(cond *Node, then *Node, els *Node) *Node {
-	node := NewNode(NDIf, nil, nil)
+func NewNodeBool(val bool, tok *Token) *Node {
+	node := NewNode(NDNum, nil, nil, tok)
+	node.Type = typeBool
+
+	if val {
+		node.Val = 1
+	}
+
+	return node
+}
+
+func NewNodeIf(cond *Node, then *Node, els *Node, tok *Token) *Node {
+	node := NewNode(NDIf, nil, nil, tok)
 	node.Cond = cond
 	node.Then = then
 	node.Else = els
@@ -72,8 +166,8 @@ func NewNodeIf(cond *Node, then *Node, els *Node) *Node {
 	return node
 }
 
-func NewNodeFor(ini *Node, cond *Node, inc *Node, then *Node) *Node {
-	node := NewNode(NDFor, nil, nil)
+func NewNodeFor(ini *Node, cond *Node, inc *Node, then *Node, tok *Token) *Node {
+	node := NewNode(NDFor, nil, nil, tok)
 	node.Init = ini
 	node.Cond = cond
 	node.Inc = inc
@@ -82,29 +176,36 @@ func NewNodeFor(ini *Node, cond *Node, inc *Node, then *Node) *Node {
 	return node
 }
 
-func NewNodeFuncCall(name []rune, args *Node) *Node {
-	node := NewNode(NDFuncCall, nil, nil)
+func NewNodeFuncCall(name []rune, args *Node, tok *Token) *Node {
+	node := NewNode(NDFuncCall, nil, nil, tok)
 	node.Name = name
 	node.Args = args
 
 	return node
 }
 
-func NewNodeFuncDef(name []rune, params *Node, body *Node, locals *Node, size int) *Node {
-	node := NewNode(NDFuncDef, nil, nil)
+func NewNodeFuncDef(name []rune, params *Node, ret *Type, body *Node, locals *Var, tok *Token) *Node {
+	node := NewNode(NDFuncDef, nil, nil, tok)
 	node.Name = name
 	node.Params = params
+	node.Type = ret
 	node.Body = body
 	node.Locals = locals
-	node.Size = size
 
 	return node
 }
 
-func NewNodeLocalValue(name []rune, offset int) *Node {
-	node := NewNode(NDLocalV, nil, nil)
-	node.Name = name
-	node.Offset = offset
+// 変数を1つ宣言する
+// initがnilの場合はゼロ値で初期化する.
+func NewNodeVarDecl(v *Var, init *Node, tok *Token) *Node {
+	node := NewNode(NDVarDecl, NewNodeLocalValue(v, tok), init, tok)
+
+	return node
+}
+
+func NewNodeLocalValue(v *Var, tok *Token) *Node {
+	node := NewNode(NDLocalV, nil, nil, tok)
+	node.Var = v
 
 	return node
 }
@@ -113,10 +214,49 @@ func (node *Node) Len() int {
 	return len(node.Name)
 }
 
-func (node *Node) FindValue(name []rune) *Node {
-	for val := localValue.Root; val != nil; val = val.Next {
-		if val.Len() == len(name) && string(name) == string(val.Name) {
-			return val
+// ノードとその子孫を、Nextで繋がったものも含めてすべてたどる.
+func walk(node *Node, f func(*Node)) {
+	for ; node != nil; node = node.Next {
+		f(node)
+
+		for _, child := range []*Node{
+			node.Left, node.Right, node.Cond, node.Then, node.Else, node.Init, node.Inc,
+			node.Body, node.Args, node.Low, node.High, node.Max,
+		} {
+			walk(child, f)
+		}
+	}
+}
+
+// 新しいスコープに入る.
+func enterScope() {
+	scope = &Scope{Up: scope}
+}
+
+// 現在のスコープを抜け、そこで宣言された変数を返す.
+func leaveScope() *Var {
+	vars := scope.Vars
+	scope = scope.Up
+
+	return vars
+}
+
+// スコープ内の変数を名前で探す.
+func (sc *Scope) Find(name []rune) *Var {
+	for v := sc.Vars; v != nil; v = v.Next {
+		if string(name) == string(v.Name) {
+			return v
+		}
+	}
+
+	return nil
+}
+
+// 内側のスコープから順にローカル変数を名前で探す.
+func findVar(name []rune) *Var {
+	for sc := scope; sc != nil; sc = sc.Up {
+		if v := sc.Find(name); v != nil {
+			return v
 		}
 	}
 
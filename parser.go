@@ -1,538 +1,2398 @@
 package main
 
-func parse() (*Node, error) {
-	head := NewNode(NDUndefined, nil, nil)
+import "fmt"
+
+func parse(inputs []*UserInput) (*Node, error) {
+	head := NewNode(NDUndefined, nil, nil, nil)
+	cur := head
+
+	collectTypeDecls(currentToken)
+
+	// 現在読んでいるソースファイルと、package節を読んだソースファイル
+	var file *UserInput
+
+	read := make(map[*UserInput]bool)
+
+	for !currentToken.AtEOF() {
+		// ファイルの先頭にはpackage節が必要
+		if currentToken.Input != file {
+			file = currentToken.Input
+			read[file] = true
+			tok := currentToken
+
+			if err := packageClause(); err != nil {
+				if err := recoverStmt(tok, err); err != nil {
+					return nil, err
+				}
+			}
+
+			continue
+		}
+
+		var (
+			node *Node
+			err  error
+		)
+
+		switch tok := currentToken; {
+		case tok.Consume(TKType):
+			err = typeDecl()
+		case tok.Consume(TKVar):
+			proceedToken()
+
+			node, err = globalVarDecl(tok)
+		case tok.Consume(TKConst):
+			proceedToken()
+
+			node, err = constDecl(declareGlobals)
+		default:
+			node, err = function()
+		}
+
+		if err != nil {
+			if err := recoverDecl(err); err != nil {
+				return nil, err
+			}
+
+			continue
+		}
+
+		// 括弧でまとめた宣言は複数のノードになる
+		for ; node != nil; node = node.Next {
+			cur.Next = node
+			cur = node
+		}
+
+		// 宣言の区切り
+		if !currentToken.AtEOF() {
+			if err := currentToken.Expect(TKReserved, ';'); err != nil {
+				if err := errorList.Add(err); err != nil {
+					return nil, err
+				}
+
+				continue
+			}
+
+			proceedToken()
+		}
+	}
+
+	// トークンが1つもないファイルにもpackage節が必要
+	for _, input := range inputs {
+		if !read[input] {
+			if err := errorList.Add(input.Err(len(input.Src), "'package'ではありません")); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := errorList.Err(); err != nil {
+		return nil, err
+	}
+
+	return head.Next, nil
+}
+
+// エラーを記録し、startから始まる文の次の文の先頭までトークンを読み飛ばす
+// ';'の次、またはブロックを閉じる'}'の手前で止まる.
+func recoverStmt(start *Token, err error) error {
+	if err := errorList.Add(err); err != nil {
+		return err
+	}
+
+	// 複合リテラルの'}'でブロックを閉じないように、括弧の深さは文の先頭から数える
+	var depth int
+
+	for tok := start; tok != currentToken && !tok.AtEOF(); tok = tok.Next {
+		switch {
+		case tok.Consume(TKReserved, '{'):
+			depth++
+		case tok.Consume(TKReserved, '}'):
+			depth--
+		}
+	}
+
+	for !currentToken.AtEOF() {
+		switch {
+		case currentToken.Consume(TKReserved, ';') && depth == 0:
+			proceedToken()
+
+			return nil
+		case currentToken.Consume(TKReserved, '{'):
+			depth++
+		case currentToken.Consume(TKReserved, '}'):
+			if depth == 0 {
+				return nil
+			}
+
+			depth--
+		}
+
+		proceedToken()
+	}
+
+	return nil
+}
+
+// エラーを記録し、次の宣言の先頭までトークンを読み飛ばす
+// 読み飛ばしたブロックの'}'とそれに続く';'の次、または宣言のキーワードの手前で止まる.
+func recoverDecl(err error) error {
+	if err := errorList.Add(err); err != nil {
+		return err
+	}
+
+	var depth int
+
+	for tok := currentToken; !currentToken.AtEOF(); {
+		switch {
+		case declKeyword(currentToken) && depth == 0 && currentToken != tok:
+			return nil
+		case currentToken.Consume(TKReserved, '{'):
+			depth++
+		case currentToken.Consume(TKReserved, '}'):
+			depth--
+
+			if depth <= 0 {
+				proceedToken()
+
+				// 宣言の区切り
+				if currentToken.Consume(TKReserved, ';') {
+					proceedToken()
+				}
+
+				return nil
+			}
+		}
+
+		proceedToken()
+	}
+
+	return nil
+}
+
+// パッケージレベルの宣言の先頭のキーワードであれば真を返す.
+func declKeyword(tok *Token) bool {
+	return tok.Consume(TKFunc) || tok.Consume(TKType) || tok.Consume(TKVar) || tok.Consume(TKConst)
+}
+
+// package main ;.
+func packageClause() error {
+	if err := currentToken.Expect(TKPackage); err != nil {
+		return err
+	}
+
+	proceedToken()
+
+	if err := currentToken.Expect(TKIdent); err != nil {
+		return err
+	}
+
+	if string(currentToken.Str) != "main" {
+		return currentToken.Err("package mainではありません")
+	}
+
+	proceedToken()
+
+	if err := currentToken.Expect(TKReserved, ';'); err != nil {
+		return err
+	}
+
+	proceedToken()
+
+	return nil
+}
+
+// パッケージレベルの型宣言
+// 型名は宣言より前でも使えるので、宣言を読む前に使われたらその場で型の式を読む.
+type TypeDecl struct {
+	Name *Token
+	Type *Type // 型の式を読み終えるまで大きさと境界は0
+
+	// 型の式の後ろのトークン
+	// 読み終えていなければnil
+	End *Token
+
+	Reading bool // 型の式を読んでいる途中
+	Failed  bool // 型の式に誤りがあった
+}
+
+// パッケージレベルの型宣言を集める
+// 構文解析を始める前に、全ての型名と型の式の位置を調べておく.
+func collectTypeDecls(tok *Token) {
+	var depth int
+
+	for ; !tok.AtEOF(); tok = tok.Next {
+		switch {
+		case tok.Consume(TKReserved, '{'), tok.Consume(TKReserved, '('):
+			depth++
+		case tok.Consume(TKReserved, '}'), tok.Consume(TKReserved, ')'):
+			depth--
+		case tok.Consume(TKType) && depth == 0 && tok.Next.Kind == TKIdent:
+			name := string(tok.Next.Str)
+
+			// 重複した宣言はその宣言を読むときに報告する
+			if _, ok := typeDecls[name]; !ok {
+				typeDecls[name] = &TypeDecl{Name: tok.Next, Type: &Type{Name: name}}
+			}
+		}
+	}
+}
+
+// 型宣言の型の式を読み、宣言された型を完成させる
+// 読み終えた後も、現在のトークンは読む前の位置に戻す.
+func readTypeDecl(decl *TypeDecl) error {
+	// 関数の中から読むこともあるので、配列の長さの式はパッケージレベルの名前で読む
+	tok, sc, iv := currentToken, scope, iotaValue
+	currentToken, scope, iotaValue = decl.Name.Next, nil, -1
+	decl.Reading = true
+
+	ty, err := typeExpr()
+	if err == nil && ty.Align == 0 {
+		err = decl.Name.Err(fmt.Sprintf("不正な再帰型です: %s", decl.Type.Name))
+	}
+
+	end := currentToken
+	currentToken, scope, iotaValue = tok, sc, iv
+	decl.Reading = false
+
+	if err != nil {
+		decl.Failed = true
+
+		return err
+	}
+
+	name := decl.Type.Name
+	*decl.Type = *ty
+	decl.Type.Name = name
+	decl.End = end
+
+	if decl.Type.Pending {
+		pendingTypes = append(pendingTypes, decl.Type)
+	}
+
+	return nil
+}
+
+// type name type
+// 宣言中の型は、構造体のフィールドの型の中でポインタの指す先として使える.
+func typeDecl() error {
+	proceedToken()
+
+	if err := currentToken.Expect(TKIdent); err != nil {
+		return err
+	}
+
+	tok := currentToken
+	name := string(tok.Str)
+
+	decl, ok := typeDecls[name]
+	if !ok {
+		decl = &TypeDecl{Name: tok, Type: &Type{Name: name}}
+		typeDecls[name] = decl
+	}
+
+	if decl.Name != tok {
+		return tok.Err(fmt.Sprintf("%sは既に宣言されています", name))
+	}
+
+	proceedToken()
+
+	// 宣言より前で使われて読み終えている
+	if decl.End != nil {
+		currentToken = decl.End
+
+		return nil
+	}
+
+	// 使われた時点で誤りがあった宣言も、誤りはここで報告する
+	if err := readTypeDecl(decl); err != nil {
+		return err
+	}
+
+	currentToken = decl.End
+
+	return nil
+}
+
+// func name ( params ) type? { body }.
+func function() (*Node, error) {
+	if err := currentToken.Expect(TKFunc); err != nil {
+		return nil, err
+	}
+
+	proceedToken()
+
+	if err := currentToken.Expect(TKIdent); err != nil {
+		return nil, err
+	}
+
+	tok := currentToken
+
+	proceedToken()
+
+	if err := currentToken.Expect(TKReserved, '('); err != nil {
+		return nil, err
+	}
+
+	proceedToken()
+
+	// 引数と関数本体の変数は同じスコープに属する
+	scope = nil
+	enterScope()
+
+	labels = make(map[string]*Token)
+	usedLabels = make(map[string]bool)
+
+	params, err := funcParams()
+	if err != nil {
+		return nil, err
+	}
+
+	ret := typeVoid
+	namedResults = nil
+
+	if !currentToken.Consume(TKReserved, '{') {
+		if ret, err = funcResults(); err != nil {
+			return nil, err
+		}
+	}
+
+	// 複数の語からなる戻り値の書き込み先を指す隠れた引数
+	var results *Var
+
+	if ret.IsAggregate() {
+		results = newTempVar()
+		results.Type = NewPointerType(ret)
+	}
+
+	if err := currentToken.Expect(TKReserved, '{'); err != nil {
+		return nil, err
+	}
+
+	proceedToken()
+
+	body, err := block()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkUnusedLabels(); err != nil {
+		return nil, err
+	}
+
+	// 名前付きの戻り値はゼロ値で初期化しておく
+	stmts := body.Body
+
+	for i := len(namedResults) - 1; i >= 0; i-- {
+		decl := NewNodeVarDecl(namedResults[i], nil, tok)
+		decl.Next = stmts
+		stmts = decl
+	}
+
+	body.Body = stmts
+
+	node := NewNodeFuncDef(tok.Str, params, ret, body, leaveScope(), tok)
+	node.Var = results
+
+	return node, nil
+}
+
+// 定義されたが使われていないラベルを報告する.
+func checkUnusedLabels() error {
+	for name, tok := range labels {
+		if usedLabels[name] {
+			continue
+		}
+
+		if err := errorList.Add(tok.Err(fmt.Sprintf("ラベル%sが使われていません", name))); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// a int, b, c int ).
+func funcParams() (*Node, error) {
+	head := NewNode(NDUndefined, nil, nil, nil)
+	cur := head
+
+	// 型が決まっていない引数
+	var pending []*Var
+
+	for !currentToken.Consume(TKReserved, ')') {
+		if cur != head {
+			if err := currentToken.Expect(TKReserved, ','); err != nil {
+				return nil, err
+			}
+
+			proceedToken()
+
+			// 末尾のカンマ
+			if currentToken.Consume(TKReserved, ')') && len(pending) == 0 {
+				break
+			}
+		}
+
+		if err := currentToken.Expect(TKIdent); err != nil {
+			return nil, err
+		}
+
+		v, err := declareVar(currentToken)
+		if err != nil {
+			return nil, err
+		}
+
+		node := NewNodeLocalValue(v, currentToken)
+
+		proceedToken()
+
+		cur.Next = node
+		cur = node
+
+		pending = append(pending, node.Var)
+
+		// 型が後ろの引数とまとめて書かれている
+		if currentToken.Consume(TKReserved, ',') {
+			continue
+		}
+
+		ty, err := typeExpr()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, v := range pending {
+			v.Type = ty
+		}
+
+		pending = nil
+	}
+
+	proceedToken()
+
+	return head.Next, nil
+}
+
+// 戻り値の型
+// type
+// ( type, ... )
+// ( name type, name, name type, ... )
+// 名前付きの戻り値は関数のスコープに宣言し、namedResultsに記録する.
+func funcResults() (*Type, error) {
+	if !currentToken.Consume(TKReserved, '(') {
+		return typeExpr()
+	}
+
+	proceedToken()
+
+	// 名前と型の組
+	// 名前だけ、または型だけが書かれていればもう一方はnil
+	type result struct {
+		name *Token
+		ty   *Type
+	}
+
+	var (
+		results []result
+		named   bool
+	)
+
+	for !currentToken.Consume(TKReserved, ')') {
+		if len(results) > 0 {
+			if err := currentToken.Expect(TKReserved, ','); err != nil {
+				return nil, err
+			}
+
+			proceedToken()
+
+			// 末尾のカンマ
+			if currentToken.Consume(TKReserved, ')') {
+				break
+			}
+		}
+
+		tok := currentToken
+
+		// 名前か型名か、この時点では分からない
+		if tok.ConsumeIdent() && (tok.Skip().Consume(TKReserved, ',') || tok.Skip().Consume(TKReserved, ')')) {
+			proceedToken()
+
+			results = append(results, result{name: tok})
+
+			continue
+		}
+
+		var name *Token
+
+		if tok.ConsumeIdent() && !isTypeName(tok) {
+			name = tok
+			named = true
+
+			proceedToken()
+		}
+
+		ty, err := typeExpr()
+		if err != nil {
+			return nil, err
+		}
+
+		results = append(results, result{name: name, ty: ty})
+	}
+
+	closing := currentToken
+
+	proceedToken()
+
+	types := make([]*Type, len(results))
+
+	// 型が後ろの戻り値とまとめて書かれている
+	var pending *Type
+
+	for i := len(results) - 1; i >= 0; i-- {
+		r := results[i]
+
+		switch {
+		case !named && r.ty == nil:
+			ty, err := lookupType(r.name)
+			if err != nil {
+				return nil, err
+			}
+
+			types[i] = ty
+		case !named:
+			types[i] = r.ty
+		case r.name == nil || (r.ty == nil && pending == nil):
+			return nil, closing.Err("名前付きの戻り値と名前のない戻り値が混在しています")
+		default:
+			if r.ty != nil {
+				pending = r.ty
+			}
+
+			v, err := declareVar(r.name)
+			if err != nil {
+				return nil, err
+			}
+
+			v.Type = pending
+			types[i] = pending
+			namedResults = append([]*Var{v}, namedResults...)
+		}
+	}
+
+	switch len(types) {
+	case 0:
+		return typeVoid, nil
+	case 1:
+		return types[0], nil
+	}
+
+	return NewTupleType(types), nil
+}
+
+// 型名、またはポインタ型、配列型、スライス型を読み進める.
+func typeExpr() (*Type, error) {
+	if currentToken.Consume(TKStruct) {
+		proceedToken()
+
+		return structType()
+	}
+
+	if currentToken.Consume(TKReserved, '*') {
+		proceedToken()
+
+		base, err := typeExpr()
+		if err != nil {
+			return nil, err
+		}
+
+		return NewPointerType(base), nil
+	}
+
+	if currentToken.Consume(TKReserved, '[') {
+		proceedToken()
+
+		if currentToken.Consume(TKReserved, ']') {
+			proceedToken()
+
+			base, err := typeExpr()
+			if err != nil {
+				return nil, err
+			}
+
+			return NewSliceType(base), nil
+		}
+
+		// 長さは定数式で、値は型検査で求める
+		n, err := innerExpr()
+		if err != nil {
+			return nil, err
+		}
+
+		if err := currentToken.Expect(TKReserved, ']'); err != nil {
+			return nil, err
+		}
+
+		proceedToken()
+
+		base, err := typeExpr()
+		if err != nil {
+			return nil, err
+		}
+
+		return NewArrayTypeOf(base, n), nil
+	}
+
+	if err := currentToken.Expect(TKIdent); err != nil {
+		return nil, err
+	}
+
+	ty, err := lookupType(currentToken)
+	if err != nil {
+		return nil, err
+	}
+
+	proceedToken()
+
+	return ty, nil
+}
+
+// struct { name, ... type ; ... }
+// 最後のフィールドの後の;は省略できる.
+func structType() (*Type, error) {
+	if err := currentToken.Expect(TKReserved, '{'); err != nil {
+		return nil, err
+	}
+
+	proceedToken()
+
+	var fields []*Field
+
+	for !currentToken.Consume(TKReserved, '}') {
+		names, err := identList()
+		if err != nil {
+			return nil, err
+		}
+
+		tok := currentToken
+
+		ty, err := typeExpr()
+		if err != nil {
+			return nil, err
+		}
+
+		// 宣言中の型そのものをフィールドに含めることはできない
+		if ty.Align == 0 {
+			return nil, tok.Err(fmt.Sprintf("不正な再帰型です: %s", ty))
+		}
+
+		for _, name := range names {
+			for _, f := range fields {
+				if string(f.Name) == string(name.Str) {
+					return nil, name.Err(fmt.Sprintf("フィールド%sは既に宣言されています", string(name.Str)))
+				}
+			}
+
+			fields = append(fields, &Field{Name: name.Str, Type: ty})
+		}
+
+		if currentToken.Consume(TKReserved, '}') {
+			break
+		}
+
+		if err := currentToken.Expect(TKReserved, ';'); err != nil {
+			return nil, err
+		}
+
+		proceedToken()
+	}
+
+	proceedToken()
+
+	return NewStructType(fields), nil
+}
+
+// 型名の型を返す.
+func lookupType(tok *Token) (*Type, error) {
+	// 宣言より前で使われた型は、その場で型の式を読む
+	// 誤りは宣言を読むときに報告する
+	if decl, ok := typeDecls[string(tok.Str)]; ok {
+		if decl.End == nil && !decl.Reading && !decl.Failed {
+			_ = readTypeDecl(decl)
+		}
+
+		return decl.Type, nil
+	}
+
+	ty, ok := predeclaredTypes[string(tok.Str)]
+	if !ok {
+		return nil, tok.Err(fmt.Sprintf("未定義の型です: %s", string(tok.Str)))
+	}
+
+	return ty, nil
+}
+
+// 識別子が型名であれば真を返す
+// 同じ名前の変数があれば、変数の方を優先する.
+func isTypeName(tok *Token) bool {
+	if findVar(tok.Str) != nil {
+		return false
+	}
+
+	_, named := typeDecls[string(tok.Str)]
+	_, predeclared := predeclaredTypes[string(tok.Str)]
+
+	return named || predeclared
+}
+
+// 新しいスコープの中で構文を読み、そこで宣言された変数をノードに記録する.
+func withScope(f func() (*Node, error)) (*Node, error) {
+	enterScope()
+
+	node, err := f()
+	vars := leaveScope()
+
+	if err != nil {
+		return nil, err
+	}
+
+	node.Locals = vars
+
+	return node, nil
+}
+
+func block() (*Node, error) {
+	node := NewNode(NDBlock, nil, nil, currentToken)
+
+	body, err := stmtList()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := currentToken.Expect(TKReserved, '}'); err != nil {
+		return nil, err
+	}
+
+	proceedToken()
+
+	node.Body = body
+
+	return node, nil
+}
+
+// 文の並びを読む
+// ブロックを閉じる'}'、またはcase, defaultの手前で止まる.
+func stmtList() (*Node, error) {
+	head := NewNode(NDBlock, nil, nil, nil)
+
+	cur := head
+
+	for !currentToken.Consume(TKReserved, '}') && !currentToken.Consume(TKCase) && !currentToken.Consume(TKDefault) {
+		if currentToken.AtEOF() {
+			return nil, currentToken.Expect(TKReserved, '}')
+		}
+
+		// 空文
+		if currentToken.Consume(TKReserved, ';') {
+			proceedToken()
+
+			continue
+		}
+
+		tok := currentToken
+
+		node, err := stmt()
+		if err == nil {
+			cur.Next = node
+			cur = node
+
+			// 文の区切りのセミコロンは'}'の手前では省略できる
+			if !currentToken.Consume(TKReserved, '}') {
+				if err = currentToken.Expect(TKReserved, ';'); err == nil {
+					proceedToken()
+				}
+			}
+		}
+
+		if err != nil {
+			if err := recoverStmt(tok, err); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return head.Next, nil
+}
+
+func stmt() (*Node, error) {
+	tok := currentToken
+
+	switch {
+	case tok.Consume(TKReturn):
+		proceedToken()
+
+		return stmtReturn(tok)
+	case tok.Consume(TKIf):
+		proceedToken()
+
+		return withScope(func() (*Node, error) { return stmtIf(tok) })
+	case tok.Consume(TKFor):
+		proceedToken()
+
+		return withScope(func() (*Node, error) { return stmtFor(tok, nil) })
+	case tok.Consume(TKSwitch):
+		proceedToken()
+
+		return withScope(func() (*Node, error) { return stmtSwitch(tok, nil) })
+	case tok.Consume(TKFallthrough):
+		proceedToken()
+
+		return NewNode(NDFallthrough, nil, nil, tok), nil
+	case tok.Consume(TKBreak):
+		proceedToken()
+
+		return stmtBranch(NDBreak, tok)
+	case tok.Consume(TKContinue):
+		proceedToken()
+
+		return stmtBranch(NDContinue, tok)
+	case tok.ConsumeIdent() && tok.Skip().Consume(TKReserved, ':'):
+		return labeledStmt()
+	case tok.Consume(TKVar):
+		proceedToken()
+
+		return stmtVar(tok)
+	case tok.Consume(TKConst):
+		proceedToken()
+
+		return stmtConst(tok)
+	case tok.Consume(TKReserved, '{'):
+		proceedToken()
+
+		return withScope(block)
+	default:
+		return simpleStmt()
+	}
+}
+
+// label : stmt.
+func labeledStmt() (*Node, error) {
+	tok := currentToken
+
+	proceedToken()
+	proceedToken()
+
+	name := string(tok.Str)
+
+	if _, ok := labels[name]; ok {
+		return nil, tok.Err(fmt.Sprintf("ラベル%sは既に定義されています", name))
+	}
+
+	labels[name] = tok
+
+	if forTok := currentToken; forTok.Consume(TKFor) {
+		proceedToken()
+
+		return withScope(func() (*Node, error) { return stmtFor(forTok, tok) })
+	}
+
+	if switchTok := currentToken; switchTok.Consume(TKSwitch) {
+		proceedToken()
+
+		return withScope(func() (*Node, error) { return stmtSwitch(switchTok, tok) })
+	}
+
+	return stmt()
+}
+
+// break label?
+// continue label?
+func stmtBranch(kind NodeKind, tok *Token) (*Node, error) {
+	node := NewNode(kind, nil, nil, tok)
+
+	if currentToken.ConsumeIdent() {
+		node.Name = currentToken.Str
+		usedLabels[string(node.Name)] = true
+
+		proceedToken()
+	}
+
+	for i := len(breakTargets) - 1; i >= 0; i-- {
+		target := breakTargets[i]
+
+		if node.Name != nil && string(node.Name) != string(target.Name) {
+			continue
+		}
+
+		if kind == NDContinue && target.Kind != NDFor {
+			if node.Name != nil {
+				break
+			}
+
+			continue
+		}
+
+		node.Target = target
+
+		return node, nil
+	}
+
+	if node.Name == nil {
+		return nil, tok.Err(fmt.Sprintf("%sはループの外では使えません", string(tok.Str)))
+	}
+
+	if _, ok := labels[string(node.Name)]; !ok {
+		return nil, tok.Err(fmt.Sprintf("ラベルが定義されていません: %s", string(node.Name)))
+	}
+
+	return nil, tok.Err(fmt.Sprintf("%sの対象にできないラベルです: %s", string(tok.Str), string(node.Name)))
+}
+
+// 式文、短い変数宣言、代入文、またはインクリメント・デクリメント文.
+func simpleStmt() (*Node, error) {
+	if isShortVarDecl() {
+		return shortVarDecl()
+	}
+
+	node, err := expr()
+	if err != nil {
+		return nil, err
+	}
+
+	if currentToken.Consume(TKReserved, ',') || currentToken.Consume(TKReserved, '=') {
+		return assignment(node)
+	}
+
+	if tok := currentToken; tok.Consume(TKReserved, []rune("++")...) {
+		proceedToken()
+
+		return opAssign(node, NDAdd, NewNodeNum(1, tok), tok)
+	}
+
+	if tok := currentToken; tok.Consume(TKReserved, []rune("--")...) {
+		proceedToken()
+
+		return opAssign(node, NDSub, NewNodeNum(1, tok), tok)
+	}
+
+	if op, ok := consumeAssignOp(); ok {
+		tok := currentToken
+
+		proceedToken()
+
+		right, err := expr()
+		if err != nil {
+			return nil, err
+		}
+
+		return opAssign(node, op.kind, right, tok)
+	}
+
+	return node, nil
+}
+
+// lhs, ... = rhs, ...
+// firstは読み終えた最初の左辺.
+func assignment(first *Node) (*Node, error) {
+	if currentToken.Consume(TKReserved, ',') {
+		proceedToken()
+
+		rest, err := exprList()
+		if err != nil {
+			return nil, err
+		}
+
+		first.Next = rest
+	}
+
+	tok := currentToken
+
+	if err := tok.Expect(TKReserved, '='); err != nil {
+		return nil, err
+	}
+
+	proceedToken()
+
+	right, err := exprList()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewNode(NDAssign, first, right, tok), nil
+}
+
+// 次のトークンが複合代入演算子であれば、対応する二項演算子を返す
+// 複合代入演算子は算術演算子の後ろに=を付けたもの.
+func consumeAssignOp() (binaryOp, bool) {
+	for _, ops := range binaryOps[:2] {
+		for _, op := range ops {
+			if currentToken.Consume(TKReserved, []rune(op.op+"=")...) {
+				return op, true
+			}
+		}
+	}
+
+	return binaryOp{}, false
+}
+
+// 複合代入文 A op= B を A = A op B に変換する
+// Aが変数でなければ、Aを一度だけ評価するように
+// tmp := &A; *tmp = *tmp op B とする
+// 式として使えないように、全体をブロックで包む.
+func opAssign(left *Node, kind NodeKind, right *Node, tok *Token) (*Node, error) {
+	node := NewNode(NDBlock, nil, nil, tok)
+
+	if left.Kind == NDLocalV {
+		node.Body = NewNode(NDAssign, left, NewNode(kind, left, right, tok), tok)
+
+		return node, nil
+	}
+
+	if !addressable(left) {
+		return nil, left.Tok.Err("代入できません")
+	}
+
+	v := newTempVar()
+
+	deref := func() *Node {
+		return NewNode(NDDereference, NewNodeLocalValue(v, tok), nil, tok)
+	}
+
+	node.Body = NewNodeVarDecl(v, NewNode(NDAddress, left, nil, tok), tok)
+	node.Body.Next = NewNode(NDAssign, deref(), NewNode(kind, deref(), right, tok), tok)
+
+	return node, nil
+}
+
+// 次のトークンから name, ... := が続くか調べる.
+func isShortVarDecl() bool {
+	for tok := currentToken; tok.ConsumeIdent(); tok = tok.Skip().Skip() {
+		if tok.Skip().Consume(TKReserved, []rune(":=")...) {
+			return true
+		}
+
+		if !tok.Skip().Consume(TKReserved, ',') {
+			return false
+		}
+	}
+
+	return false
+}
+
+// name, ... := expr, ...
+// 同じスコープで宣言済みの変数には代入だけを行う
+// 少なくとも1つは新しい変数でなければならない.
+func shortVarDecl() (*Node, error) {
+	tok := currentToken
+
+	names, err := identList()
+	if err != nil {
+		return nil, err
+	}
+
+	op := currentToken
+
+	proceedToken()
+
+	// 右辺では宣言する変数はまだ見えない
+	right, err := exprList()
+	if err != nil {
+		return nil, err
+	}
+
+	head := NewNode(NDUndefined, nil, nil, nil)
+	cur := head
+
+	var declared bool
+
+	for i, name := range names {
+		for _, prev := range names[:i] {
+			if string(prev.Str) == string(name.Str) && string(name.Str) != "_" {
+				return nil, name.Err(fmt.Sprintf("%sが:=の左辺で繰り返されています", string(name.Str)))
+			}
+		}
+
+		switch v := scope.Find(name.Str); {
+		case string(name.Str) == "_":
+			cur.Next = NewNode(NDBlank, nil, nil, name)
+		case v != nil:
+			cur.Next = NewNodeLocalValue(v, name)
+		default:
+			if v, err = declareVar(name); err != nil {
+				return nil, err
+			}
+
+			cur.Next = NewNodeLocalValue(v, name)
+			declared = true
+		}
+
+		cur = cur.Next
+	}
+
+	if !declared {
+		return nil, op.Err(":=の左辺に新しい変数がありません")
+	}
+
+	return NewNode(NDVarDecl, head.Next, right, tok), nil
+}
+
+// var name, ... type? (= expr, ...)?
+// 括弧でまとめた宣言は1つのブロックにする.
+func stmtVar(tok *Token) (*Node, error) {
+	group := currentToken.Consume(TKReserved, '(')
+
+	decls, err := declGroup(func() (*Node, error) {
+		names, ty, right, err := varSpec()
+		if err != nil {
+			return nil, err
+		}
+
+		left, err := declareLocals(names, ty)
+		if err != nil {
+			return nil, err
+		}
+
+		return NewNode(NDVarDecl, left, right, tok), nil
+	})
+	if err != nil || !group {
+		return decls, err
+	}
+
+	node := NewNode(NDBlock, nil, nil, tok)
+	node.Body = decls
+
+	return node, nil
+}
+
+// ローカルな定数宣言
+// 括弧でまとめた宣言は1つのブロックにする.
+func stmtConst(tok *Token) (*Node, error) {
+	decls, err := constDecl(func(names []*Token, ty *Type, decl *Node) (*Node, error) {
+		vars, err := declareLocals(names, ty)
+
+		for v := vars; v != nil; v = v.Next {
+			if v.Kind == NDLocalV {
+				v.Var.Decl = decl
+			}
+		}
+
+		return vars, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	node := NewNode(NDBlock, nil, nil, tok)
+	node.Body = decls
+
+	return node, nil
+}
+
+// ローカル変数や定数を宣言し、それを表すノードの並びを返す.
+func declareLocals(names []*Token, ty *Type) (*Node, error) {
+	head := NewNode(NDUndefined, nil, nil, nil)
+	cur := head
+
+	for _, name := range names {
+		if string(name.Str) == "_" {
+			cur.Next = NewNode(NDBlank, nil, nil, name)
+			cur = cur.Next
+
+			continue
+		}
+
+		v, err := declareVar(name)
+		if err != nil {
+			return nil, err
+		}
+
+		v.Type = ty
+
+		cur.Next = NewNodeLocalValue(v, name)
+		cur = cur.Next
+	}
+
+	return head.Next, nil
+}
+
+// var, constに続く name, ... type? (= expr, ...)? の部分.
+func varSpec() ([]*Token, *Type, *Node, error) {
+	names, err := identList()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	var (
+		ty    *Type
+		right *Node
+	)
+
+	if !currentToken.Consume(TKReserved, '=') {
+		if ty, err = typeExpr(); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	if currentToken.Consume(TKReserved, '=') {
+		proceedToken()
+
+		if right, err = exprList(); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	return names, ty, right, nil
+}
+
+// パッケージレベルの var name, ... type? (= expr, ...)?
+// var ( ... ; ... )は宣言ごとのノードをNextで繋いで返す.
+func globalVarDecl(tok *Token) (*Node, error) {
+	return declGroup(func() (*Node, error) {
+		names, ty, right, err := varSpec()
+		if err != nil {
+			return nil, err
+		}
+
+		node := NewNode(NDVarDecl, nil, right, tok)
+
+		if node.Left, err = declareGlobals(names, ty, node); err != nil {
+			return nil, err
+		}
+
+		return node, nil
+	})
+}
+
+// const name, ... type? = expr, ...
+// const ( name, ... (type? = expr, ...)? ; ... )
+// 括弧でまとめた宣言で値を省略すると、直前の宣言の型と値の式を繰り返す
+// iotaはまとめた宣言の中で何番目の宣言かを表す
+// declareで名前を宣言する
+// 値は型検査で求める.
+func constDecl(declare func(names []*Token, ty *Type, decl *Node) (*Node, error)) (*Node, error) {
+	var (
+		i      int
+		ty     *Type
+		values *Token // 直前の宣言の値の式の先頭
+	)
+
+	return declGroup(func() (*Node, error) {
+		names, err := identList()
+		if err != nil {
+			return nil, err
+		}
+
+		// 型も値もなければ、直前の宣言の値の式を読み直してから元の位置に戻る
+		next := currentToken
+
+		if !currentToken.Consume(TKReserved, ';') && !currentToken.Consume(TKReserved, ')') {
+			ty = nil
+
+			if !currentToken.Consume(TKReserved, '=') {
+				if ty, err = typeExpr(); err != nil {
+					return nil, err
+				}
+			}
+
+			if err := currentToken.Expect(TKReserved, '='); err != nil {
+				return nil, currentToken.Err("定数の値がありません")
+			}
+
+			proceedToken()
+
+			values, next = currentToken, nil
+		} else if values == nil {
+			return nil, currentToken.Err("定数の値がありません")
+		}
+
+		iotaValue = i
+		currentToken = values
+
+		right, err := exprList()
+
+		iotaValue = -1
+		i++
+
+		if err != nil {
+			return nil, err
+		}
+
+		if next != nil {
+			currentToken = next
+		}
+
+		node := NewNode(NDConstDecl, nil, right, names[0])
+
+		if node.Left, err = declare(names, ty, node); err != nil {
+			return nil, err
+		}
+
+		return node, nil
+	})
+}
+
+// 宣言を1つ、または括弧でまとめた宣言を読む
+// specで宣言を1つ読み、宣言ごとのノードをNextで繋いで返す.
+func declGroup(spec func() (*Node, error)) (*Node, error) {
+	if !currentToken.Consume(TKReserved, '(') {
+		return spec()
+	}
+
+	proceedToken()
+
+	head := NewNode(NDUndefined, nil, nil, nil)
+	cur := head
+
+	for !currentToken.Consume(TKReserved, ')') {
+		node, err := spec()
+		if err != nil {
+			return nil, err
+		}
+
+		cur.Next = node
+		cur = node
+
+		if currentToken.Consume(TKReserved, ')') {
+			break
+		}
+
+		if err := currentToken.Expect(TKReserved, ';'); err != nil {
+			return nil, err
+		}
+
+		proceedToken()
+	}
+
+	proceedToken()
+
+	return head.Next, nil
+}
+
+// パッケージレベルの変数や定数を宣言し、それを表すノードの並びを返す.
+func declareGlobals(names []*Token, ty *Type, decl *Node) (*Node, error) {
+	head := NewNode(NDUndefined, nil, nil, nil)
+	cur := head
+
+	for _, name := range names {
+		if string(name.Str) == "_" {
+			cur.Next = NewNode(NDBlank, nil, nil, name)
+			cur = cur.Next
+
+			continue
+		}
+
+		if _, ok := globalVars[string(name.Str)]; ok {
+			return nil, name.Err(fmt.Sprintf("%sは既に宣言されています", string(name.Str)))
+		}
+
+		v := &Var{Name: name.Str, Type: ty, Decl: decl}
+		globalVars[string(name.Str)] = v
+
+		cur.Next = NewNode(NDGlobalV, nil, nil, name)
+		cur.Next.Var = v
+		cur = cur.Next
+	}
+
+	return head.Next, nil
+}
+
+// name (, name)*.
+func identList() ([]*Token, error) {
+	var names []*Token
+
+	for {
+		if err := currentToken.Expect(TKIdent); err != nil {
+			return nil, err
+		}
+
+		names = append(names, currentToken)
+
+		proceedToken()
+
+		if !currentToken.Consume(TKReserved, ',') {
+			return names, nil
+		}
+
+		proceedToken()
+	}
+}
+
+// if (init ;)? cond { ... } (else (if ... | { ... }))?
+// if文全体で1つのスコープを作る.
+func stmtIf(tok *Token) (*Node, error) {
+	noCompositeLit = true
+	ini, cond, err := ifHeader()
+	noCompositeLit = false
+
+	if err != nil {
+		return nil, err
+	}
+
+	then, err := bracedBlock()
+	if err != nil {
+		return nil, err
+	}
+
+	var els *Node
+
+	if currentToken.Consume(TKElse) {
+		proceedToken()
+
+		if elseTok := currentToken; elseTok.Consume(TKIf) {
+			proceedToken()
+
+			els, err = withScope(func() (*Node, error) { return stmtIf(elseTok) })
+		} else {
+			els, err = bracedBlock()
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	node := NewNodeIf(cond, then, els, tok)
+	node.Init = ini
+
+	return node, nil
+}
+
+// if文の(init ;)? cond の部分.
+func ifHeader() (*Node, *Node, error) {
+	var ini *Node
+
+	if !currentToken.Consume(TKReserved, ';') {
+		node, err := simpleStmt()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if currentToken.Consume(TKReserved, '{') {
+			cond, err := condition(node)
+
+			return nil, cond, err
+		}
+
+		if !currentToken.Consume(TKReserved, ';') {
+			return nil, nil, currentToken.Expect(TKReserved, '{')
+		}
+
+		ini = node
+	}
+
+	if err := currentToken.Expect(TKReserved, ';'); err != nil {
+		return nil, nil, err
+	}
+
+	proceedToken()
+
+	node, err := simpleStmt()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cond, err := condition(node)
+
+	return ini, cond, err
+}
+
+// 条件式として読んだ文が式であることを確かめる.
+func condition(node *Node) (*Node, error) {
+	if node.Kind == NDVarDecl || node.Kind == NDBlock || node.Kind == NDAssign {
+		return nil, node.Tok.Err("条件式ではありません")
+	}
+
+	return node, nil
+}
+
+// if, forの本体
+// 波括弧は省略できない.
+func bracedBlock() (*Node, error) {
+	if err := currentToken.Expect(TKReserved, '{'); err != nil {
+		return nil, err
+	}
+
+	proceedToken()
+
+	return withScope(block)
+}
+
+// switch (init ;)? tag? { (case expr, ... | default) : stmts ... }
+// switch文全体で1つのスコープを作る
+// labelはswitch文に付けられたラベルで、なければnil.
+func stmtSwitch(tok *Token, label *Token) (*Node, error) {
+	noCompositeLit = true
+	ini, tag, err := switchHeader()
+	noCompositeLit = false
+
+	if err != nil {
+		return nil, err
+	}
+
+	node := NewNode(NDSwitch, nil, nil, tok)
+	node.Init = ini
+	node.Cond = tag
+
+	if label != nil {
+		node.Name = label.Str
+	}
+
+	// タグの値は一度だけ評価して一時変数に保存する
+	if tag != nil {
+		node.Var = newTempVar()
+	}
+
+	proceedToken()
+
+	breakTargets = append(breakTargets, node)
+	clauses, err := caseClauses()
+	breakTargets = breakTargets[:len(breakTargets)-1]
+
+	if err != nil {
+		return nil, err
+	}
+
+	node.Body = clauses
+
+	return node, nil
+}
+
+// switch文の波括弧の手前までを読む
+// タグのないswitch文ではtagはnil.
+func switchHeader() (*Node, *Node, error) {
+	if currentToken.Consume(TKReserved, '{') {
+		return nil, nil, nil
+	}
+
+	var ini *Node
+
+	if !currentToken.Consume(TKReserved, ';') {
+		node, err := simpleStmt()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// switch tag { ... }
+		if currentToken.Consume(TKReserved, '{') {
+			tag, err := condition(node)
+
+			return nil, tag, err
+		}
+
+		if !currentToken.Consume(TKReserved, ';') {
+			return nil, nil, currentToken.Expect(TKReserved, '{')
+		}
+
+		ini = node
+	}
+
+	proceedToken()
+
+	if currentToken.Consume(TKReserved, '{') {
+		return ini, nil, nil
+	}
+
+	node, err := simpleStmt()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := currentToken.Expect(TKReserved, '{'); err != nil {
+		return nil, nil, err
+	}
+
+	tag, err := condition(node)
+
+	return ini, tag, err
+}
+
+// switch文の本体のcase節の並びを読む.
+func caseClauses() (*Node, error) {
+	head := NewNode(NDUndefined, nil, nil, nil)
 	cur := head
 
-	for !currentToken.AtEOF() {
-		node, err := function()
+	var def *Node
+
+	for !currentToken.Consume(TKReserved, '}') {
+		if currentToken.AtEOF() {
+			return nil, currentToken.Expect(TKReserved, '}')
+		}
+
+		clause, err := withScope(caseClause)
 		if err != nil {
-			return nil, err
+			if err := recoverCase(err); err != nil {
+				return nil, err
+			}
+
+			continue
 		}
 
-		cur.Next = node
-		cur = node
+		if clause.Args == nil {
+			if def != nil {
+				if err := errorList.Add(clause.Tok.Err("defaultが複数あります")); err != nil {
+					return nil, err
+				}
+			}
+
+			def = clause
+		}
+
+		cur.Next = clause
+		cur = clause
 	}
 
+	proceedToken()
+
 	return head.Next, nil
 }
 
-func function() (*Node, error) {
-	if err := currentToken.Expect(TKIdent); err != nil {
-		return nil, err
-	}
+// case expr, ... : stmts
+// default : stmts
+// 節ごとに1つのスコープを作る
+// defaultの場合、Argsはnil.
+func caseClause() (*Node, error) {
+	tok := currentToken
 
-	funcName := currentToken.Str
+	node := NewNode(NDCase, nil, nil, tok)
 
-	proceedToken()
+	switch {
+	case tok.Consume(TKCase):
+		proceedToken()
 
-	if err := currentToken.Expect(TKReserved, '('); err != nil {
+		args, err := exprList()
+		if err != nil {
+			return nil, err
+		}
+
+		node.Args = args
+	case tok.Consume(TKDefault):
+		proceedToken()
+	default:
+		return nil, tok.Err("caseまたはdefaultではありません")
+	}
+
+	if err := currentToken.Expect(TKReserved, ':'); err != nil {
 		return nil, err
 	}
 
 	proceedToken()
 
-	params, err := funcParams()
+	body, err := stmtList()
 	if err != nil {
 		return nil, err
 	}
 
-	if err := currentToken.Expect(TKReserved, '{'); err != nil {
-		return nil, err
-	}
+	node.Body = body
 
-	proceedToken()
+	return node, nil
+}
 
-	head := NewNode(NDLocalV, nil, nil)
-	localValue = head
-	localValue.Root = head
+// expr (, expr)*.
+func exprList() (*Node, error) {
+	head := NewNode(NDUndefined, nil, nil, nil)
+	cur := head
 
-	body, err := block()
-	if err != nil {
-		return nil, err
+	for {
+		node, err := expr()
+		if err != nil {
+			return nil, err
+		}
+
+		cur.Next = node
+		cur = node
+
+		if !currentToken.Consume(TKReserved, ',') {
+			return head.Next, nil
+		}
+
+		proceedToken()
+	}
+}
+
+// エラーを記録し、次のcase節の先頭までトークンを読み飛ばす
+// case, default、またはswitch文を閉じる'}'の手前で止まる.
+func recoverCase(err error) error {
+	if err := errorList.Add(err); err != nil {
+		return err
 	}
 
-	var localNum int
-	for local := head.Next; local != nil; local = local.Next {
-		localNum++
+	var depth int
+
+	for tok := currentToken; !currentToken.AtEOF(); proceedToken() {
+		switch {
+		case (currentToken.Consume(TKCase) || currentToken.Consume(TKDefault)) && depth == 0 && currentToken != tok:
+			return nil
+		case currentToken.Consume(TKReserved, '{'):
+			depth++
+		case currentToken.Consume(TKReserved, '}'):
+			if depth == 0 {
+				return nil
+			}
+
+			depth--
+		}
 	}
 
-	return NewNodeFuncDef(funcName, params, body, head.Next, localNum*offsetSize), nil
+	return nil
 }
 
-func funcParams() (*Node, error) {
-	if currentToken.Consume(TKReserved, ')') {
-		proceedToken()
+// return expr, ...
+// 名前付きの戻り値を持つ関数では、値を省略するとその変数の値を返す.
+func stmtReturn(tok *Token) (*Node, error) {
+	if currentToken.Consume(TKReserved, ';') || currentToken.Consume(TKReserved, '}') {
+		head := NewNode(NDUndefined, nil, nil, nil)
+		cur := head
+
+		for _, v := range namedResults {
+			cur.Next = NewNodeLocalValue(v, tok)
+			cur = cur.Next
+		}
 
-		return nil, nil
+		return NewNode(NDReturn, head.Next, nil, tok), nil
 	}
 
-	head, err := assign()
+	left, err := exprList()
 	if err != nil {
 		return nil, err
 	}
 
-	cur := head
+	return NewNode(NDReturn, left, nil, tok), nil
+}
 
-	for currentToken.Consume(TKReserved, ',') {
-		proceedToken()
+// for { ... }
+// for cond { ... }
+// for init? ; cond? ; post? { ... }
+// for文全体で1つのスコープを作る
+// labelはfor文に付けられたラベルで、なければnil.
+func stmtFor(tok *Token, label *Token) (*Node, error) {
+	var (
+		ini  *Node
+		cond *Node
+		inc  *Node
+		err  error
+	)
+
+	if !currentToken.Consume(TKReserved, '{') {
+		noCompositeLit = true
+		ini, cond, inc, err = forClause()
+		noCompositeLit = false
 
-		node, err := assign()
 		if err != nil {
 			return nil, err
 		}
+	}
 
-		cur.Next = node
+	node := NewNodeFor(ini, cond, inc, nil, tok)
 
-		cur = cur.Next
+	if label != nil {
+		node.Name = label.Str
 	}
 
-	if err := currentToken.Expect(TKReserved, ')'); err != nil {
+	breakTargets = append(breakTargets, node)
+	then, err := bracedBlock()
+	breakTargets = breakTargets[:len(breakTargets)-1]
+
+	if err != nil {
 		return nil, err
 	}
 
-	proceedToken()
+	node.Then = then
 
-	return head, nil
+	return node, nil
 }
 
-func block() (*Node, error) {
-	node := NewNode(NDBlock, nil, nil)
+// for文の波括弧の手前までを読む.
+func forClause() (*Node, *Node, *Node, error) {
+	var (
+		ini  *Node
+		cond *Node
+		inc  *Node
+		err  error
+	)
 
-	head := NewNode(NDBlock, nil, nil)
+	if !currentToken.Consume(TKReserved, ';') {
+		node, err := simpleStmt()
+		if err != nil {
+			return nil, nil, nil, err
+		}
 
-	cur := head
+		// for cond { ... }
+		if currentToken.Consume(TKReserved, '{') {
+			cond, err := condition(node)
 
-	for {
-		node, err := stmt()
-		if err != nil {
-			return nil, err
+			return nil, cond, nil, err
 		}
 
-		cur.Next = node
-		cur = node
+		if !currentToken.Consume(TKReserved, ';') {
+			return nil, nil, nil, currentToken.Expect(TKReserved, '{')
+		}
 
-		if currentToken.Consume(TKReserved, '}') {
-			proceedToken()
+		ini = node
+	}
 
-			break
+	if err := currentToken.Expect(TKReserved, ';'); err != nil {
+		return nil, nil, nil, err
+	}
+
+	proceedToken()
+
+	if !currentToken.Consume(TKReserved, ';') {
+		if cond, err = expr(); err != nil {
+			return nil, nil, nil, err
 		}
 	}
 
-	node.Body = head.Next
+	if err := currentToken.Expect(TKReserved, ';'); err != nil {
+		return nil, nil, nil, err
+	}
 
-	return node, nil
+	proceedToken()
+
+	if !currentToken.Consume(TKReserved, '{') {
+		if inc, err = simpleStmt(); err != nil {
+			return nil, nil, nil, err
+		}
+
+		if inc.Kind == NDVarDecl {
+			return nil, nil, nil, inc.Tok.Err("for文の後処理で変数を宣言できません")
+		}
+	}
+
+	return ini, cond, inc, nil
 }
 
-func stmt() (*Node, error) {
-	switch {
-	case currentToken.Consume(TKReturn):
-		proceedToken()
+func expr() (*Node, error) {
+	return binary(len(binaryOps))
+}
 
-		return stmtReturn()
-	case currentToken.Consume(TKIf):
-		proceedToken()
+// 括弧や波括弧の内側の式
+// if, for, switchのヘッダの中でも複合リテラルを使える.
+func innerExpr() (*Node, error) {
+	prev := noCompositeLit
+	noCompositeLit = false
 
-		return stmtIf()
-	case currentToken.Consume(TKFor):
-		proceedToken()
+	node, err := expr()
+
+	noCompositeLit = prev
+
+	return node, err
+}
+
+// 二項演算子とそのノードの種類.
+type binaryOp struct {
+	op   string
+	kind NodeKind
+	swap bool // 左右の被演算子を入れ替える
+}
+
+// 優先順位の高いものから順に並べた二項演算子.
+var binaryOps = [][]binaryOp{
+	{{"*", NDMul, false}, {"/", NDDiv, false}, {"%", NDMod, false}, {"<<", NDShl, false}, {">>", NDShr, false}, {"&", NDBitAnd, false}, {"&^", NDAndNot, false}},
+	{{"+", NDAdd, false}, {"-", NDSub, false}, {"|", NDBitOr, false}, {"^", NDBitXor, false}},
+	{{"==", NDEq, false}, {"!=", NDNe, false}, {"<", NDLt, false}, {"<=", NDLe, false}, {">", NDLt, true}, {">=", NDLe, true}},
+	{{"&&", NDLogAnd, false}},
+	{{"||", NDLogOr, false}},
+}
+
+// 優先順位がprec以上の二項演算子からなる式
+// 優先順位は1から始まり、0は単項演算子の式を表す
+// 同じ優先順位の演算子は左結合.
+func binary(prec int) (*Node, error) {
+	if prec == 0 {
+		return unary()
+	}
+
+	node, err := binary(prec - 1)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		op, ok := consumeBinaryOp(binaryOps[prec-1])
+		if !ok {
+			return node, nil
+		}
+
+		tok := currentToken
 
-		return stmtFor()
-	case currentToken.Consume(TKReserved, '{'):
 		proceedToken()
 
-		return block()
-	default:
-		node, err := expr()
+		right, err := binary(prec - 1)
 		if err != nil {
 			return nil, err
 		}
 
-		if err := currentToken.Expect(TKReserved, ';'); err != nil {
-			return nil, err
+		if op.swap {
+			node = NewNode(op.kind, right, node, tok)
+		} else {
+			node = NewNode(op.kind, node, right, tok)
 		}
-
-		proceedToken()
-
-		return node, nil
 	}
 }
 
-func stmtIf() (*Node, error) {
-	// ブロックスコープができたら削る
-	if err := currentToken.Expect(TKReserved, '('); err != nil {
-		return nil, err
+// 次のトークンがopsのいずれかの演算子であればそれを返す.
+func consumeBinaryOp(ops []binaryOp) (binaryOp, bool) {
+	for _, op := range ops {
+		if currentToken.Consume(TKReserved, []rune(op.op)...) {
+			return op, true
+		}
 	}
 
-	proceedToken()
+	return binaryOp{}, false
+}
 
-	cond, err := expr()
-	if err != nil {
-		return nil, err
+func unary() (*Node, error) {
+	tok := currentToken
+
+	if tok.Consume(TKReserved, '+') {
+		proceedToken()
+
+		return unary()
 	}
 
-	// ブロックスコープができたら削る
-	if err := currentToken.Expect(TKReserved, ')'); err != nil {
-		return nil, err
+	if tok.Consume(TKReserved, '-') {
+		proceedToken()
+
+		node, err := unary()
+		if err != nil {
+			return nil, err
+		}
+
+		return NewNode(NDSub, NewNodeNum(0, tok), node, tok), nil
 	}
 
-	proceedToken()
+	if tok.Consume(TKReserved, '*') {
+		proceedToken()
 
-	stm, err := stmt()
-	if err != nil {
-		return nil, err
+		node, err := unary()
+		if err != nil {
+			return nil, err
+		}
+
+		return NewNode(NDDereference, node, nil, tok), nil
 	}
 
-	var els *Node
+	if tok.Consume(TKReserved, '!') {
+		proceedToken()
 
-	if currentToken.Consume(TKElse) {
+		node, err := unary()
+		if err != nil {
+			return nil, err
+		}
+
+		return NewNode(NDNot, node, nil, tok), nil
+	}
+
+	if tok.Consume(TKReserved, '^') {
 		proceedToken()
 
-		var err error
-		if els, err = stmt(); err != nil {
+		node, err := unary()
+		if err != nil {
 			return nil, err
 		}
+
+		return NewNode(NDBitNot, node, nil, tok), nil
 	}
 
-	node := NewNodeIf(cond, stm, els)
+	if tok.Consume(TKReserved, '&') {
+		proceedToken()
+
+		node, err := unary()
+		if err != nil {
+			return nil, err
+		}
+
+		return NewNode(NDAddress, node, nil, tok), nil
+	}
 
-	return node, nil
+	return postfix()
 }
 
-func stmtReturn() (*Node, error) {
-	left, err := expr()
+// primary ("[" expr "]" | "[" expr? ":" expr? (":" expr)? "]" | "." ident)*.
+func postfix() (*Node, error) {
+	node, err := primary()
 	if err != nil {
 		return nil, err
 	}
 
-	node := NewNode(NDReturn, left, nil)
+	for {
+		tok := currentToken
 
-	if err := currentToken.Expect(TKReserved, ';'); err != nil {
-		return nil, err
-	}
+		if tok.Consume(TKReserved, '.') {
+			proceedToken()
 
-	proceedToken()
+			if err := currentToken.Expect(TKIdent); err != nil {
+				return nil, err
+			}
 
-	return node, nil
-}
+			node = NewNode(NDMember, node, nil, currentToken)
+			node.Name = currentToken.Str
 
-func stmtFor() (*Node, error) {
-	// ブロックスコープができたら削る
-	if err := currentToken.Expect(TKReserved, '('); err != nil {
-		return nil, err
-	}
+			proceedToken()
 
-	proceedToken()
+			continue
+		}
 
-	var (
-		ini  *Node
-		cond *Node
-		inc  *Node
-	)
+		if !tok.Consume(TKReserved, '[') {
+			return node, nil
+		}
 
-	if currentToken.Consume(TKReserved, ';') {
 		proceedToken()
-	} else {
-		var err error
-		if ini, err = expr(); err != nil {
-			return nil, err
+
+		var index *Node
+
+		if !currentToken.Consume(TKReserved, ':') {
+			if index, err = innerExpr(); err != nil {
+				return nil, err
+			}
 		}
 
-		if err := currentToken.Expect(TKReserved, ';'); err != nil {
+		if currentToken.Consume(TKReserved, ':') {
+			if node, err = sliceExpr(node, index, tok); err != nil {
+				return nil, err
+			}
+
+			continue
+		}
+
+		if err := currentToken.Expect(TKReserved, ']'); err != nil {
 			return nil, err
 		}
 
 		proceedToken()
+
+		node = NewNode(NDIndex, node, index, tok)
 	}
+}
+
+// a[lo:hi:max]の最初の:以降
+// 3つの添字を持つ場合、2つ目と3つ目の添字は省略できない.
+func sliceExpr(operand *Node, lo *Node, tok *Token) (*Node, error) {
+	proceedToken()
+
+	node := NewNode(NDSlice, operand, nil, tok)
+	node.Low = lo
 
-	if currentToken.Consume(TKReserved, ';') {
-		proceedToken()
-	} else {
-		var err error
-		if cond, err = expr(); err != nil {
+	var err error
+
+	if !currentToken.Consume(TKReserved, ']') && !currentToken.Consume(TKReserved, ':') {
+		if node.High, err = innerExpr(); err != nil {
 			return nil, err
 		}
+	}
 
-		if err := currentToken.Expect(TKReserved, ';'); err != nil {
-			return nil, err
+	if currentToken.Consume(TKReserved, ':') {
+		if node.High == nil {
+			return nil, currentToken.Err("3つの添字を持つスライス式では2つ目の添字を省略できません")
 		}
 
 		proceedToken()
-	}
 
-	if currentToken.Consume(TKReserved, ')') {
-		proceedToken()
-	} else {
-		var err error
-		if inc, err = expr(); err != nil {
-			return nil, err
+		if currentToken.Consume(TKReserved, ']') {
+			return nil, currentToken.Err("3つの添字を持つスライス式では3つ目の添字を省略できません")
 		}
 
-		if err := currentToken.Expect(TKReserved, ')'); err != nil {
+		if node.Max, err = innerExpr(); err != nil {
 			return nil, err
 		}
-
-		proceedToken()
 	}
 
-	then, err := stmt()
-	if err != nil {
+	if err := currentToken.Expect(TKReserved, ']'); err != nil {
 		return nil, err
 	}
 
-	return NewNodeFor(ini, cond, inc, then), nil
-}
+	proceedToken()
 
-func expr() (*Node, error) {
-	return assign()
+	return node, nil
 }
 
-func assign() (*Node, error) {
-	node, err := equality()
-	if err != nil {
-		return nil, err
-	}
-
-	if currentToken.Consume(TKReserved, '=') {
+func primary() (*Node, error) {
+	if currentToken.Consume(TKReserved, '(') {
 		proceedToken()
 
-		right, err := equality()
+		node, err := innerExpr()
 		if err != nil {
 			return nil, err
 		}
 
-		return NewNode(NDAssign, node, right), nil
-	}
+		if err := currentToken.Expect(TKReserved, ')'); err != nil {
+			return nil, err
+		}
 
-	return node, nil
-}
+		proceedToken()
 
-func equality() (*Node, error) {
-	node, err := relational()
-	if err != nil {
-		return nil, err
+		return node, nil
 	}
 
-	for {
-		if currentToken.Consume(TKReserved, []rune("==")...) {
-			proceedToken()
-
-			right, err := relational()
-			if err != nil {
-				return nil, err
-			}
+	if currentToken.ConsumeIdent() {
+		return ident()
+	}
 
-			node = NewNode(NDEq, node, right)
+	tok := currentToken
 
-			continue
-		}
+	if tok.Consume(TKStr) {
+		proceedToken()
 
-		if currentToken.Consume(TKReserved, []rune("!=")...) {
-			proceedToken()
+		return NewNode(NDStr, nil, nil, tok), nil
+	}
 
-			right, err := relational()
-			if err != nil {
-				return nil, err
-			}
+	if tok.Consume(TKReserved, '[') {
+		return compositeLit()
+	}
 
-			node = NewNode(NDNe, node, right)
+	if tok.Consume(TKRune) {
+		proceedToken()
 
-			continue
-		}
+		node := NewNodeNum(tok.Val, tok)
+		node.Type = typeUntypedRune
 
 		return node, nil
 	}
-}
 
-func relational() (*Node, error) {
-	node, err := add()
+	n, err := tok.ExpectNum()
 	if err != nil {
 		return nil, err
 	}
 
-	for {
-		if currentToken.Consume(TKReserved, []rune("<")...) {
-			proceedToken()
+	proceedToken()
 
-			right, err := add()
-			if err != nil {
-				return nil, err
-			}
+	// int型で表せない値も型のない定数として持つ
+	node := NewNodeNum(n, tok)
+	node.Const = tok.Const
+
+	return node, nil
+}
 
-			node = NewNode(NDLt, node, right)
+func ident() (*Node, error) {
+	if currentToken.Skip().Consume(TKReserved, '{') && !noCompositeLit && isTypeName(currentToken) {
+		return compositeLit()
+	}
 
-			continue
+	if currentToken.Skip().Consume(TKReserved, '(') {
+		if isTypeName(currentToken) {
+			return conversion()
 		}
 
-		if currentToken.Consume(TKReserved, []rune("<=")...) {
-			proceedToken()
+		if findVar(currentToken.Str) == nil && string(currentToken.Str) == "make" {
+			return makeCall()
+		}
 
-			right, err := add()
-			if err != nil {
-				return nil, err
-			}
+		return identFuncCall()
+	}
 
-			node = NewNode(NDLe, node, right)
+	node, err := identVal()
 
-			continue
-		}
+	proceedToken()
 
-		if currentToken.Consume(TKReserved, []rune(">")...) {
-			proceedToken()
+	return node, err
+}
 
-			left, err := add()
-			if err != nil {
-				return nil, err
-			}
+func identVal() (*Node, error) {
+	tok := currentToken
+
+	// ブランク識別子
+	if string(tok.Str) == "_" {
+		return NewNode(NDBlank, nil, nil, tok), nil
+	}
 
-			node = NewNode(NDLt, left, node)
+	if v := findVar(tok.Str); v != nil {
+		return NewNodeLocalValue(v, tok), nil
+	}
 
-			continue
+	// 事前宣言された定数とnil
+	switch string(tok.Str) {
+	case "iota":
+		if iotaValue >= 0 {
+			return NewNodeNum(iotaValue, tok), nil
 		}
+	case "true":
+		return NewNodeBool(true, tok), nil
+	case "false":
+		return NewNodeBool(false, tok), nil
+	case "nil":
+		return NewNode(NDNil, nil, nil, tok), nil
+	}
 
-		if currentToken.Consume(TKReserved, []rune(">=")...) {
-			proceedToken()
+	// パッケージレベルの宣言は後に続くこともあるので、型検査で探す
+	node := NewNode(NDGlobalV, nil, nil, tok)
+	node.Name = tok.Str
 
-			left, err := add()
-			if err != nil {
-				return nil, err
-			}
+	return node, nil
+}
 
-			node = NewNode(NDLe, left, node)
+// 名前を持たない一時変数を現在のスコープに追加する
+// 型は型検査で決める.
+func newTempVar() *Var {
+	v := &Var{Next: scope.Vars}
 
-			continue
-		}
+	scope.Vars = v
 
-		return node, nil
-	}
+	return v
 }
 
-func add() (*Node, error) {
-	node, err := mul()
-	if err != nil {
-		return nil, err
+// 現在のスコープにローカル変数を宣言する
+// 同じスコープに同じ名前の変数が既にあればエラーを返す.
+func declareVar(tok *Token) (*Var, error) {
+	if scope.Find(tok.Str) != nil {
+		return nil, tok.Err(fmt.Sprintf("%sは既に宣言されています", string(tok.Str)))
 	}
 
-	for {
-		if currentToken.Consume(TKReserved, '+') {
-			proceedToken()
+	v := &Var{
+		Name: tok.Str,
+		Next: scope.Vars,
+	}
 
-			right, err := mul()
-			if err != nil {
-				return nil, err
-			}
+	scope.Vars = v
 
-			node = NewNode(NDAdd, node, right)
+	return v, nil
+}
 
-			continue
-		}
+// [N]T{x, y, ...}
+// [...]T{x, y, ...}は要素の数を長さとする
+// T{f: x, ...}.
+func compositeLit() (*Node, error) {
+	tok := currentToken
 
-		if currentToken.Consume(TKReserved, '-') {
-			proceedToken()
+	var (
+		ty  *Type
+		err error
+	)
 
-			right, err := mul()
-			if err != nil {
-				return nil, err
-			}
+	if tok.Skip().Consume(TKReserved, []rune("...")...) {
+		proceedToken()
+		proceedToken()
 
-			node = NewNode(NDSub, node, right)
+		if err := currentToken.Expect(TKReserved, ']'); err != nil {
+			return nil, err
+		}
 
-			continue
+		proceedToken()
+
+		base, err := typeExpr()
+		if err != nil {
+			return nil, err
 		}
 
-		return node, nil
+		ty = NewArrayType(base, -1)
+	} else if ty, err = typeExpr(); err != nil {
+		return nil, err
 	}
+
+	return compositeElems(ty, tok)
 }
 
-func mul() (*Node, error) {
-	node, err := unary()
-	if err != nil {
+// 複合リテラルの{}の中の要素の並び
+// 配列とスライスの要素が複合リテラルの場合、その型は省略できる
+// 構造体の要素にはフィールド名を付けられる.
+func compositeElems(ty *Type, tok *Token) (*Node, error) {
+	if err := currentToken.Expect(TKReserved, '{'); err != nil {
 		return nil, err
 	}
 
-	for {
-		if currentToken.Consume(TKReserved, '*') {
-			proceedToken()
+	proceedToken()
 
-			right, err := unary()
-			if err != nil {
-				return nil, err
-			}
+	head := NewNode(NDUndefined, nil, nil, nil)
+	cur := head
 
-			node = NewNode(NDMul, node, right)
+	var n int
 
-			continue
-		}
+	for !currentToken.Consume(TKReserved, '}') {
+		if cur != head {
+			if err := currentToken.Expect(TKReserved, ','); err != nil {
+				return nil, err
+			}
 
-		if currentToken.Consume(TKReserved, '/') {
 			proceedToken()
 
-			right, err := unary()
-			if err != nil {
-				return nil, err
+			// 末尾のカンマ
+			if currentToken.Consume(TKReserved, '}') {
+				break
 			}
+		}
 
-			node = NewNode(NDDiv, node, right)
+		var (
+			elem *Node
+			err  error
+		)
+
+		switch {
+		case ty.Kind == TYStruct && currentToken.ConsumeIdent() && currentToken.Skip().Consume(TKReserved, ':'):
+			elem, err = keyedElem()
+		case currentToken.Consume(TKReserved, '{') && ty.Kind != TYStruct && elidable(ty.Base):
+			elem, err = compositeElems(ty.Base, currentToken)
+		case currentToken.Consume(TKReserved, '{') && ty.Kind != TYStruct && ty.Base.IsPointer() && elidable(ty.Base.Base):
+			// *T型の要素の&T{...}は{...}と書ける
+			tok := currentToken
+
+			if elem, err = compositeElems(ty.Base.Base, tok); err == nil {
+				elem = NewNode(NDAddress, elem, nil, tok)
+			}
+		default:
+			elem, err = innerExpr()
+		}
 
-			continue
+		if err != nil {
+			return nil, err
 		}
 
-		return node, nil
+		cur.Next = elem
+		cur = elem
+		n++
 	}
-}
 
-func unary() (*Node, error) {
-	if currentToken.Consume(TKReserved, '+') {
-		proceedToken()
+	proceedToken()
 
-		return unary()
+	if ty.Kind == TYArray && ty.Len < 0 {
+		ty = NewArrayType(ty.Base, n)
 	}
 
-	if currentToken.Consume(TKReserved, '-') {
-		proceedToken()
-
-		node, err := unary()
-		if err != nil {
-			return nil, err
-		}
+	node := NewNode(NDCompLit, nil, nil, tok)
+	node.Args = head.Next
+	node.Type = ty
 
-		return NewNode(NDSub, NewNodeNum(0), node), nil
-	}
+	return node, nil
+}
 
-	if currentToken.Consume(TKReserved, '*') {
-		proceedToken()
+// 構造体の複合リテラルのフィールド名の付いた要素 f: x.
+func keyedElem() (*Node, error) {
+	tok := currentToken
 
-		node, err := unary()
-		if err != nil {
-			return nil, err
-		}
+	proceedToken()
+	proceedToken()
 
-		return NewNode(NDDereference, node, nil), nil
+	val, err := innerExpr()
+	if err != nil {
+		return nil, err
 	}
 
-	if currentToken.Consume(TKReserved, '&') {
-		proceedToken()
-
-		node, err := unary()
-		if err != nil {
-			return nil, err
-		}
+	node := NewNode(NDKeyVal, val, nil, tok)
+	node.Name = tok.Str
 
-		return NewNode(NDAddress, node, nil), nil
-	}
+	return node, nil
+}
 
-	return primary()
+// 複合リテラルの要素として、型を省略した複合リテラルを書ける型であれば真を返す.
+func elidable(ty *Type) bool {
+	return ty.Kind == TYArray || ty.Kind == TYSlice || ty.Kind == TYStruct
 }
 
-func primary() (*Node, error) {
-	if currentToken.Consume(TKReserved, '(') {
-		proceedToken()
+// make(T, args...)
+// 型を引数に取るため、構文解析の時点で組み込み関数の呼び出しとして扱う.
+func makeCall() (*Node, error) {
+	tok := currentToken
 
-		node, err := expr()
-		if err != nil {
-			return nil, err
-		}
+	proceedToken()
+	proceedToken()
+
+	ty, err := typeExpr()
+	if err != nil {
+		return nil, err
+	}
+
+	node := NewNode(NDMake, nil, nil, tok)
+	node.Type = ty
 
+	if !currentToken.Consume(TKReserved, ',') {
 		if err := currentToken.Expect(TKReserved, ')'); err != nil {
 			return nil, err
 		}
@@ -542,49 +2402,52 @@ func primary() (*Node, error) {
 		return node, nil
 	}
 
-	if currentToken.ConsumeIdent() {
-		return ident()
-	}
+	proceedToken()
 
-	n, err := currentToken.ExpectNum()
-	if err != nil {
+	if node.Args, node.Ellipsis, err = funcCallArgs(); err != nil {
 		return nil, err
 	}
 
-	proceedToken()
-
-	return NewNodeNum(n), nil
+	return node, nil
 }
 
-func ident() (*Node, error) {
-	if currentToken.Skip().Consume(TKReserved, '(') {
-		return identFuncCall()
-	}
+// T(x)
+// 変換先の型をノードの型として持つ.
+func conversion() (*Node, error) {
+	tok := currentToken
 
-	node, err := identVal()
+	ty, err := lookupType(tok)
+	if err != nil {
+		return nil, err
+	}
 
+	proceedToken()
 	proceedToken()
 
-	return node, err
-}
+	left, err := innerExpr()
+	if err != nil {
+		return nil, err
+	}
 
-func identVal() (*Node, error) {
-	if lv := localValue.FindValue(currentToken.Str); lv != nil {
-		return lv, nil
+	// 末尾のカンマ
+	if currentToken.Consume(TKReserved, ',') {
+		proceedToken()
 	}
 
-	node := NewNodeLocalValue(currentToken.Str, localValue.Offset+offsetSize)
+	if err := currentToken.Expect(TKReserved, ')'); err != nil {
+		return nil, err
+	}
 
-	localValue.Next = node
-	node.Root = localValue.Root
+	proceedToken()
 
-	localValue = node
+	node := NewNode(NDConv, left, nil, tok)
+	node.Type = ty
 
 	return node, nil
 }
 
 func identFuncCall() (*Node, error) {
-	funcName := currentToken.Str
+	tok := currentToken
 
 	proceedToken()
 
@@ -594,46 +2457,66 @@ func identFuncCall() (*Node, error) {
 
 	proceedToken()
 
-	args, err := funcCallArgs()
+	args, ellipsis, err := funcCallArgs()
 	if err != nil {
 		return nil, err
 	}
 
-	return NewNodeFuncCall(funcName, args), nil
+	node := NewNodeFuncCall(tok.Str, args, tok)
+	node.Ellipsis = ellipsis
+
+	return node, nil
 }
 
-func funcCallArgs() (*Node, error) {
-	if currentToken.Consume(TKReserved, ')') {
-		proceedToken()
+// 関数呼び出しの引数の並び
+// 最後の引数に...が付いていれば真を返す.
+func funcCallArgs() (*Node, bool, error) {
+	head := NewNode(NDUndefined, nil, nil, nil)
+	cur := head
 
-		return nil, nil
-	}
+	var ellipsis bool
 
-	head, err := assign()
-	if err != nil {
-		return nil, err
-	}
+	for !currentToken.Consume(TKReserved, ')') {
+		if cur != head {
+			if err := currentToken.Expect(TKReserved, ','); err != nil {
+				return nil, false, err
+			}
 
-	cur := head
+			proceedToken()
 
-	for currentToken.Consume(TKReserved, ',') {
-		proceedToken()
+			// 末尾のカンマ
+			if currentToken.Consume(TKReserved, ')') {
+				break
+			}
+		}
 
-		node, err := assign()
+		node, err := innerExpr()
 		if err != nil {
-			return nil, err
+			return nil, false, err
 		}
 
 		cur.Next = node
+		cur = node
 
-		cur = cur.Next
-	}
+		if currentToken.Consume(TKReserved, []rune("...")...) {
+			proceedToken()
 
-	if err := currentToken.Expect(TKReserved, ')'); err != nil {
-		return nil, err
+			ellipsis = true
+
+			// 末尾のカンマ
+			if currentToken.Consume(TKReserved, ',') {
+				proceedToken()
+			}
+
+			if err := currentToken.Expect(TKReserved, ')'); err != nil {
+				return nil, false, err
+			}
+
+			break
+		}
 	}
 
 	proceedToken()
 
-	return head, nil
+	return head.Next, ellipsis, nil
 }
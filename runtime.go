@@ -0,0 +1,171 @@
+package main
+
+// 生成したコードから呼び出す実行時ライブラリを出力する
+// どの関数もCの呼び出し規約に従う.
+func genRuntime() {
+	genConcatString()
+	genCmpString()
+	genMakeSlice()
+	genGrowSlice()
+	genPanic("went.panicIndex", "index out of range")
+	genPanic("went.panicSlice", "slice bounds out of range")
+	genPanic("went.panicMakeSlice", "makeslice: len out of range")
+}
+
+// went.concatstring(dst, a, b *string) *string
+// aとbを連結した文字列を新しく確保した領域に作り、dstに書き込む.
+func genConcatString() {
+	output.L("went.concatstring:")
+	output.L("  push rbp")
+	output.L("  mov rbp, rsp")
+	output.L("  sub rsp, 32")
+	output.L("  mov [rbp-8], rdi")
+	output.L("  mov [rbp-16], rsi")
+	output.L("  mov [rbp-24], rdx")
+	output.L("  mov rdi, [rsi+8]")
+	output.L("  add rdi, [rdx+8]")
+	output.L("  mov [rbp-32], rdi")
+	output.L("  call malloc@PLT")
+	output.L("  mov rdi, rax")
+	output.L("  mov rsi, [rbp-16]")
+	output.L("  mov rcx, [rsi+8]")
+	output.L("  mov rsi, [rsi]")
+	output.L("  rep movsb")
+	output.L("  mov rsi, [rbp-24]")
+	output.L("  mov rcx, [rsi+8]")
+	output.L("  mov rsi, [rsi]")
+	output.L("  rep movsb")
+	output.L("  mov rdi, [rbp-8]")
+	output.L("  mov [rdi], rax")
+	output.L("  mov rcx, [rbp-32]")
+	output.L("  mov [rdi+8], rcx")
+	output.L("  mov rax, rdi")
+	output.L("  mov rsp, rbp")
+	output.L("  pop rbp")
+	output.L("  ret")
+}
+
+// went.cmpstring(a, b *string) int
+// aとbを辞書順に比べ、aが小さければ-1、等しければ0、大きければ1を返す.
+func genCmpString() {
+	output.L("went.cmpstring:")
+	output.L("  mov rcx, [rdi+8]")
+	output.L("  mov rdx, [rsi+8]")
+
+	// 短い方の長さだけバイトごとに比べる
+	output.L("  mov r8, rdx")
+	output.L("  cmp rcx, rdx")
+	output.L("  cmovb r8, rcx")
+	output.L("  mov rdi, [rdi]")
+	output.L("  mov rsi, [rsi]")
+	output.L(".L.cmpstring.loop:")
+	output.L("  cmp r8, 0")
+	output.L("  je  .L.cmpstring.len")
+	output.L("  movzx eax, byte ptr [rdi]")
+	output.L("  movzx r9d, byte ptr [rsi]")
+	output.L("  cmp eax, r9d")
+	output.L("  jb  .L.cmpstring.less")
+	output.L("  ja  .L.cmpstring.greater")
+	output.L("  add rdi, 1")
+	output.L("  add rsi, 1")
+	output.L("  sub r8, 1")
+	output.L("  jmp .L.cmpstring.loop")
+
+	// 共通部分が等しければ短い方が小さい
+	output.L(".L.cmpstring.len:")
+	output.L("  cmp rcx, rdx")
+	output.L("  jb  .L.cmpstring.less")
+	output.L("  ja  .L.cmpstring.greater")
+	output.L("  mov rax, 0")
+	output.L("  ret")
+	output.L(".L.cmpstring.less:")
+	output.L("  mov rax, -1")
+	output.L("  ret")
+	output.L(".L.cmpstring.greater:")
+	output.L("  mov rax, 1")
+	output.L("  ret")
+}
+
+// went.makeslice(dst *[]T, size, len, cap int) *[]T
+// 要素の大きさがsizeのスライスを、ゼロ値で埋めた配列を確保して作る.
+func genMakeSlice() {
+	output.L("went.makeslice:")
+	output.L("  cmp rdx, 0")
+	output.L("  jl  went.panicMakeSlice")
+	output.L("  cmp rdx, rcx")
+	output.L("  jg  went.panicMakeSlice")
+	output.L("  push rbp")
+	output.L("  mov rbp, rsp")
+	output.L("  sub rsp, 32")
+	output.L("  mov [rbp-8], rdi")
+	output.L("  mov [rbp-16], rdx")
+	output.L("  mov [rbp-24], rcx")
+	output.L("  mov rdi, rcx")
+	output.L("  call calloc@PLT")
+	output.L("  mov rdi, [rbp-8]")
+	output.L("  mov [rdi], rax")
+	output.L("  mov rcx, [rbp-16]")
+	output.L("  mov [rdi+8], rcx")
+	output.L("  mov rcx, [rbp-24]")
+	output.L("  mov [rdi+16], rcx")
+	output.L("  mov rax, rdi")
+	output.L("  mov rsp, rbp")
+	output.L("  pop rbp")
+	output.L("  ret")
+}
+
+// went.growslice(s *[]T, size, n int)
+// スライスにn個の要素を追加できるだけの容量がなければ、
+// 容量を2倍(足りなければ必要な分)にした配列を確保して要素を移す.
+func genGrowSlice() {
+	output.L("went.growslice:")
+	output.L("  mov rax, [rdi+8]")
+	output.L("  add rax, rdx")
+	output.L("  cmp rax, [rdi+16]")
+	output.L("  jg  .L.growslice.grow")
+	output.L("  ret")
+	output.L(".L.growslice.grow:")
+	output.L("  push rbp")
+	output.L("  mov rbp, rsp")
+	output.L("  sub rsp, 32")
+	output.L("  mov [rbp-8], rdi")
+	output.L("  mov [rbp-16], rsi")
+	output.L("  mov rcx, [rdi+16]")
+	output.L("  add rcx, rcx")
+	output.L("  cmp rcx, rax")
+	output.L("  cmovl rcx, rax")
+	output.L("  mov [rbp-24], rcx")
+	output.L("  mov rdi, rcx")
+	output.L("  call calloc@PLT")
+	output.L("  mov rdx, [rbp-8]")
+	output.L("  mov rdi, rax")
+	output.L("  mov rsi, [rdx]")
+	output.L("  mov rcx, [rdx+8]")
+	output.L("  imul rcx, [rbp-16]")
+	output.L("  rep movsb")
+	output.L("  mov [rdx], rax")
+	output.L("  mov rcx, [rbp-24]")
+	output.L("  mov [rdx+16], rcx")
+	output.L("  mov rsp, rbp")
+	output.L("  pop rbp")
+	output.L("  ret")
+}
+
+// 実行時エラーを標準エラー出力に書き、終了コード2で終了する.
+func genPanic(name string, msg string) {
+	msg = "panic: runtime error: " + msg + "\\n"
+
+	output.F("%s:\n", name)
+	output.L("  mov rax, 1")
+	output.L("  mov rdi, 2")
+	output.F("  lea rsi, [rip+.L.%s.msg]\n", name)
+	output.F("  mov rdx, %d\n", len(msg)-1)
+	output.L("  syscall")
+	output.L("  mov rax, 231")
+	output.L("  mov rdi, 2")
+	output.L("  syscall")
+	output.L("  .section .rodata")
+	output.F(".L.%s.msg:\n", name)
+	output.F("  .ascii \"%s\"\n", msg)
+	output.L("  .text")
+}
@@ -1,11 +1,15 @@
 #!/bin/bash
 
+# 一時ファイルはモジュールの外に作り、終了時に消す
+went="$(cd "$(dirname "$0")" && pwd)/went"
+tmpdir=$(mktemp -d) || exit 1
+trap 'rm -rf "$tmpdir"' EXIT
+cd "$tmpdir" || exit 1
 
-assert() {
+check() {
   expected="$1"
   input="$2"
 
-  ./went "$input" > tmp.s
   cc -o tmp tmp.s
   ./tmp
   actual="$?"
@@ -18,53 +22,1141 @@ assert() {
   fi
 }
 
-assert 0 'main() { return 0; }'
-assert 42 'main() { return 42; }'
-assert 21 'main() { return 5 + 20 -4; }'
-assert 41 'main() { return 12 + 34 - 5; }'
-assert 4 'main() { return (3 + 5) / 2; }'
-assert 10 'main() { return -10 + 20; }'
-assert 10 'main() { return - - + 10; }'
-
-assert 0 'main() { return 0 == 1; }'
-assert 1 'main() { return 42 == 42; }'
-assert 1 'main() { return 0 != 1; }'
-assert 0 'main() { return 42 != 42; }'
-
-assert 1 'main() { return 0 < 1; }'
-assert 0 'main() { return 1 < 1; }'
-assert 0 'main() { return 2 < 1; }'
-assert 1 'main() { return 0 <= 1; }'
-assert 1 'main() { return 1 <= 1; }'
-assert 0 'main() { return 2 <= 1; }'
-
-assert 1 'main() { return 1 > 0; }'
-assert 0 'main() { return 1 > 1; }'
-assert 0 'main() { return 1 > 2; }'
-assert 1 'main() { return 1 >= 0; }'
-assert 1 'main() { return 1 >= 1; }'
-assert 0 'main() { return 1 >= 2; }'
-
-assert 6 'main() { foo = 1; bar = 2 + 3; return foo + bar; }'
-assert 1 'main() { return 1; return 2; }'
-
-assert 3 'main() { if (0) return 2; return 3; }'
-assert 2 'main() { if (3 > 2) return 2; else return 3; }'
-assert 3 'main() { if (3 < 2) return 2; else return 3; }'
-assert 4 'main() { if (3 < 2) return 2; else if (2 < 1) return 3; else return 4; }'
-assert 4 'main() { if (3 < 2) return 2; else if (2 < 1) return 3; else return 4; }'
-
-assert 55 'main() { j = 0; for (i = 0; i <= 10; i = i + 1) j = i + j; return j; }'
-assert 3 'main() { for (;;) return 3; return 5; }'
-
-assert 3 'main() { {1; {2;} return 3;} }'
-assert 55 'main() { j = 0; for (i = 0; i <= 10; i = i + 1) {tmp = i + j; j = tmp;} return j; }'
-
-assert 32 'main() { return ret32(); } ret32() { return 32; }'
-
-assert 7 'main() { return add(3, 4); } add(x, y) { return x + y; }'
-assert 1 'main() { return sub(4, 3); } sub(x, y) { return x - y; }'
-assert 55 'main() { return fib(9); } fib(x) { if (x <= 1) { return 1; } return fib(x - 1) + fib(x - 2); }'
-assert 3 'main() { x = 3; y = &x; return *y; }'
+assert() {
+  expected="$1"
+  input="$2"
+  shift 2
+
+  echo "$input" | "$went" "$@" - > tmp.s || exit 1
+  check "$expected" "$input"
+}
+
+assert_error() {
+  expected="$1"
+  input="$2"
+  shift 2
+
+  echo "$input" > tmp.go
+  actual=$("$went" "$@" tmp.go 2>&1 > /dev/null)
+
+  if [ $? -ne 0 ] && echo "$actual" | grep -qF -- "$expected"; then
+    echo "$input => $expected"
+  else
+    echo "$input => error \"$expected\" expected, but got \"$actual\""
+    exit 1
+  fi
+}
+
+assert_files() {
+  expected="$1"
+  shift
+
+  "$went" "$@" > tmp.s || exit 1
+  check "$expected" "$*"
+}
+
+assert_asm() {
+  expected="$1"
+  input="$2"
+  shift 2
+
+  echo "$input" | "$went" "$@" - > tmp.s || exit 1
+
+  if sed 's/^ *//' tmp.s | grep -qxF -- "$expected"; then
+    echo "$input => $expected"
+  else
+    echo "$input => \"$expected\" expected in the output"
+    exit 1
+  fi
+}
+
+B2I='func b2i(b bool) int { if b { return 1; }; return 0; }'
+
+assert 0 'package main; func main() int { return 0; }'
+assert 42 'package main; func main() int { return 42; }'
+assert 21 'package main; func main() int { return 5 + 20 -4; }'
+assert 41 'package main; func main() int { return 12 + 34 - 5; }'
+assert 4 'package main; func main() int { return (3 + 5) / 2; }'
+assert 10 'package main; func main() int { return -10 + 20; }'
+assert 10 'package main; func main() int { return - - + 10; }'
+
+assert 0 "package main; $B2I
+func main() int { return b2i(0 == 1); }"
+assert 1 "package main; $B2I
+func main() int { return b2i(42 == 42); }"
+assert 1 "package main; $B2I
+func main() int { return b2i(0 != 1); }"
+assert 0 "package main; $B2I
+func main() int { return b2i(42 != 42); }"
+
+assert 1 "package main; $B2I
+func main() int { return b2i(0 < 1); }"
+assert 0 "package main; $B2I
+func main() int { return b2i(1 < 1); }"
+assert 0 "package main; $B2I
+func main() int { return b2i(2 < 1); }"
+assert 1 "package main; $B2I
+func main() int { return b2i(0 <= 1); }"
+assert 1 "package main; $B2I
+func main() int { return b2i(1 <= 1); }"
+assert 0 "package main; $B2I
+func main() int { return b2i(2 <= 1); }"
+
+assert 1 "package main; $B2I
+func main() int { return b2i(1 > 0); }"
+assert 0 "package main; $B2I
+func main() int { return b2i(1 > 1); }"
+assert 0 "package main; $B2I
+func main() int { return b2i(1 > 2); }"
+assert 1 "package main; $B2I
+func main() int { return b2i(1 >= 0); }"
+assert 1 "package main; $B2I
+func main() int { return b2i(1 >= 1); }"
+assert 0 "package main; $B2I
+func main() int { return b2i(1 >= 2); }"
+
+assert 6 'package main; func main() int { foo := 1; var bar int = 2 + 3; return foo + bar; }'
+assert 1 'package main; func main() int { return 1; return 2; }'
+
+assert 3 'package main; func main() int { if false { return 2; }; return 3; }'
+assert 2 'package main; func main() int { if 3 > 2 { return 2; } else { return 3; } }'
+assert 3 'package main; func main() int { if 3 < 2 { return 2; } else { return 3; } }'
+assert 4 'package main; func main() int { if 3 < 2 { return 2; } else if 2 < 1 { return 3; } else { return 4; } }'
+assert 3 'package main; func main() int { if 3 < 2 { return 2; } else if 1 < 2 { return 3; } else { return 4; } }'
+assert 5 'package main; func main() int { if x := 5; x > 3 { return x; } else { return 0; } }'
+assert 7 'package main; func main() int { x := 7; if y := 2; x < y { return y; } else if z := x; z > y { return z; }; return 0; }'
+assert 2 'package main; func main() int { x := 1; if ; x == 1 { x = 2; }; return x; }'
+
+assert 55 'package main; func main() int { j := 0; for i := 0; i <= 10; i = i + 1 { j = i + j; }; return j; }'
+assert 3 'package main; func main() int { for { return 3; }; return 5; }'
+assert 3 'package main; func main() int { for ;; { return 3; }; return 5; }'
+assert 10 'package main; func main() int { i := 0; for i < 10 { i = i + 1; }; return i; }'
+assert 10 'package main; func main() int { i := 0; for ; i < 10; { i = i + 1; }; return i; }'
+
+assert 3 'package main; func main() int { {1; {2;}; return 3;} }'
+assert 55 'package main; func main() int { var j int; for i := 0; i <= 10; i = i + 1 {tmp := i + j; j = tmp;}; return j; }'
+
+assert 32 'package main; func main() int { return ret32(); }
+func ret32() int { return 32; }'
+
+assert 7 'package main; func main() int { return add(3, 4); }
+func add(x int, y int) int { return x + y; }'
+assert 9 'package main; func main() int { return add3(2, 3, 4); }
+func add3(x, y int, z int) int { return x + y + z; }'
+assert 1 'package main; func main() int { return sub(4, 3); }
+func sub(x int, y int) int { return x - y; }'
+assert 55 'package main; func main() int { return fib(9); }
+func fib(x int) int { if x <= 1 { return 1; }; return fib(x - 1) + fib(x - 2); }'
+assert 3 'package main; func main() int { x := 3; y := &x; return *y; }'
+assert 5 'package main; func main() int { x := 3; y := &x; *y = 5; return x; }'
+assert 7 'package main; func main() int { x := 3; set(&x, 7); return x; }
+func set(p *int, v int) { *p = v; }'
+assert 1 'package main; func main() int { x := 3; p := &x; var q **int = &p; if **q == 3 { return 1; }; return 0; }'
+assert 1 "package main; $B2I
+func main() int { t := true; var f = false; return b2i(t != f); }"
+
+echo 'package main; func main() int { return add(ret32(), 10); }' > tmp1.go
+echo 'package main; func ret32() int { return 32; }
+func add(x int, y int) int { return x + y; }' > tmp2.go
+assert_files 42 tmp1.go tmp2.go
+
+assert 0 'package main; func main() {}'
+assert 0 'package main; func main() {}' -abi internal
+assert 0 'package main; func f() int { return 73 }; func main() { x := f(); if x > 0 { return }; x = 1 }'
+assert 0 'package main; func f() int { return 73 }; func main() { x := f(); if x > 0 { return }; x = 1 }' -abi internal
+
+assert_error 'tmp.go:3:11: トークナイズできません' $'package main;\nfunc main() int {\n\treturn 1 @ 2;\n}'
+assert_error 'tmp.go:2:27: 数ではありません' $'package main;\nfunc main() int { return -; }'
+assert_error 'tmp.go:2:39: 数ではありません' $'package main;\nfunc main() int { return 1 +; x := 2 *; }\nfunc sub() int { return 1 }'
+assert_error 'tmp.go:2:52: 数ではありません' $'package main;\nfunc main() int { if (1 { return 1 +; }; return 2 *; }\nfunc sub() int { return 1 }'
+assert_error "tmp.go:3:28: 'Reserved word: )'ではありません" $'package main;\nfunc main() int { return 1 +; x := 2 *; }\nfunc sub() int { return (1 }'
+assert_error 'too many errors' $'package main;\nfunc main() int { return 1 +; x := 2 *; }\nfunc sub() int { return (1 }' -errlimit 2
+assert_error 'tmp.go:2:47: 数ではありません' $'package main;\nfunc main() int { a := [2]int{1 2}; return 1 +; }'
+assert_error 'tmp.go:3:9: 数ではありません' $'package main; type P struct { x, y int }\nfunc main() int { if true { p := P{x: 1 y: 2}; return p.x }\nreturn *; }'
+assert_error "tmp.go:1:1: 'package'ではありません" 'func main() int { return 0; }'
+assert_error 'tmp.go:1:9: package mainではありません' 'package foo; func main() int { return 0; }'
+assert_error "tmp.go:2:1: 'package'ではありません" ''
+assert_error "tmp.go:2:1: 'package'ではありません" '// comment only'
+echo 'package main; func main() int { return 0 }' > tmp1.go
+assert_error "tmp.go:2:1: 'package'ではありません" '/* comment only */' tmp1.go
+assert_error "tmp.go:1:15: 'func'ではありません" 'package main; main() { return 0; }'
+assert_error "tmp.go:2:12: 'identifier'ではありません" 'package main; func main() int { return f(1, 2); }
+func f(a, b) int { return a; }'
+assert_error 'tmp.go:1:36: 条件式がbool型ではありません: int' 'package main; func main() int { if 1 { return 1; }; return 0; }'
+assert_error 'tmp.go:1:48: ポインタ型ではありません: int' 'package main; func main() int { x := 1; return *x; }'
+assert_error 'tmp.go:1:42: 型が一致しません: int と bool' 'package main; func main() int { return 1 + true; }'
+assert_error 'tmp.go:1:42: bool型の値をint型として使えません' 'package main; func main() int { return 1 == 1; }'
+assert_error 'tmp.go:1:47: 演算子<は*int型に使えません' 'package main; func main() int { x := 1; if &x < &x { return 1; }; return 0; }'
+assert_error 'tmp.go:1:40: 未定義の関数です: f' 'package main; func main() int { return f(); }'
+assert_error 'tmp.go:1:54: int型の値を*int型として使えません' 'package main; func main() int { x := 1; p := &x; p = 2; return x; }'
+assert 0 'package main; func main() int { var x int; return x; }'
+assert 1 "package main; $B2I
+func main() int { var x bool; var p *int; return b2i(x == false); }"
+assert 5 'package main; func main() int { x := 2; var y = x + 3; return y; }'
+assert 3 'package main; func main() int { f(); return 3; }
+func f() { return; }'
+assert_error 'tmp.go:1:33: 未定義の変数です: x' 'package main; func main() int { x = 1; return x; }'
+assert_error 'tmp.go:1:45: xは既に宣言されています' 'package main; func main() int { x := 1; var x int; return x; }'
+assert_error 'tmp.go:2:19: :=の左辺に新しい変数がありません' 'package main; func main() int { return 0; }
+func f(y int) { y := 1; }'
+assert_error 'tmp.go:1:38: 未定義の変数です: x' 'package main; func main() int { x := x + 1; return x; }'
+assert_error 'tmp.go:1:45: bool型の値をint型として使えません' 'package main; func main() int { var x int = true; return x; }'
+
+assert 1 'package main; func main() int { x := 1; { x := 2; x = x + 1; }; return x; }'
+assert 3 'package main; func main() int { x := 1; { x = 3; }; return x; }'
+assert 5 'package main; func main() int { x := 1; { y := 2; x = x + y; }; { z := 2; x = x + z; }; return x; }'
+assert 4 'package main; func main() int { x := 1; { a := 1; { b := 1; x = x + a + b; } }; { c := 1; x = x + c; }; return x; }'
+assert 10 'package main; func main() int { i := 10; for i := 0; i < 3; i = i + 1 { i := 5; i = i + 1; }; return i; }'
+assert 3 'package main; func main() int { x := 1; p := &x; { x := 2; *p = x + 1; }; return x; }'
+assert 1 'package main; func main() int { var p *int; { x := 1; p = &x }; { y := 2; y = y + 0 }; return *p }'
+assert 1 'package main; func main() int { var p *int; { x := 1; p = &x }; { y := 2; y = y + 0 }; return *p }' -abi internal
+assert 34 'package main; func main() int { var s []int; { a := [2]int{3, 4}; s = a[:] }; { b := [2]int{5, 6}; b[0] = b[1] }; return s[0]*10 + s[1] }'
+assert_error 'tmp.go:1:53: 未定義の変数です: y' 'package main; func main() int { { y := 1; }; return y; }'
+assert_error 'tmp.go:1:73: 未定義の変数です: i' 'package main; func main() int { for i := 0; i < 3; i = i + 1 {}; return i; }'
+assert_error "tmp.go:1:41: 'Reserved word: {'ではありません" 'package main; func main() int { if true return 1; return 0; }'
+assert_error 'tmp.go:1:36: 条件式ではありません' 'package main; func main() int { if x := 1 { return 1; }; return 0; }'
+assert_error 'tmp.go:1:52: for文の後処理で変数を宣言できません' 'package main; func main() int { for i := 0; i < 1; j := 1 {}; return 0; }'
+
+assert 3 'package main
+
+// 改行でセミコロンが補われる
+func main() int {
+	x := 1
+	y := 2 /* 行内のコメント */
+	if x < y {
+		x = x + y
+	}
+	return x
+}'
+assert 10 'package main
+
+func main() int {
+	i := 0
+	for i < 10 {
+		i = add(
+			i,
+			1,
+		)
+	}
+	return i /* 改行を含む
+	ブロックコメント */
+}
+
+func add(a int, b int) int { return a + b }'
+assert 4 'package main
+func main() int { x := 1;; x = x + 3; return x }'
+assert_error "tmp.go:3:9: 'Reserved word: ;'ではありません" $'package main\nfunc main() int {\n\tx := 1 y := 2\n\treturn x\n}'
+assert_error 'tmp.go:4:2: 数ではありません' $'package main\nfunc main() int {\n\tx := 1 +\n\t}'
+assert_error "tmp.go:1:44: 'Reserved word: ;'ではありません" 'package main; func main() int { return 0 } func f() {}'
+assert_error 'tmp.go:2:19: コメントが閉じられていません' $'package main\nfunc main() int { /* return 0 }'
+
+assert 5 'package main
+func main() int {
+	i := 0
+	for {
+		if i == 5 {
+			break
+		}
+		i = i + 1
+	}
+	return i
+}'
+assert 25 'package main
+func main() int {
+	sum := 0
+	for i := 0; i < 10; i = i + 1 {
+		if i/2*2 == i {
+			continue
+		}
+		sum = sum + i
+	}
+	return sum
+}'
+assert 12 'package main
+func main() int {
+	n := 0
+outer:
+	for i := 0; i < 5; i = i + 1 {
+		for j := 0; j < 5; j = j + 1 {
+			if j == 3 {
+				continue outer
+			}
+			if i == 4 {
+				break outer
+			}
+			n = n + 1
+		}
+	}
+	return n
+}'
+assert 42 'package main
+func main() int {
+	n := 0
+	for i := 0; i < 10*10*10*10*10*10; i = i + 1 {
+		n = 42
+	}
+	return n
+}'
+assert_error 'tmp.go:1:33: breakはループの外では使えません' 'package main; func main() int { break; return 0 }'
+assert_error 'tmp.go:1:35: continueはループの外では使えません' 'package main; func main() int { { continue }; return 0 }'
+assert_error 'tmp.go:1:39: ラベルが定義されていません: L' 'package main; func main() int { for { break L }; return 0 }'
+assert_error 'tmp.go:1:44: breakの対象にできないラベルです: L' 'package main; func main() int { L: { for { break L } }; return 0 }'
+assert_error 'tmp.go:1:33: ラベルLが使われていません' 'package main; func main() int { L: for { break }; return 0 }'
+assert_error 'tmp.go:1:53: ラベルLは既に定義されています' 'package main; func main() int { L: for { break L }; L: for { break L }; return 0 }'
+
+SWITCH='func f(x int) int {
+	switch x {
+	case 0:
+		return 10
+	case 1, 2:
+		return 20
+	case 3:
+		return 30
+	case 5:
+		return 50
+	default:
+		return 99
+	}
+	return 0
+}'
+assert 10 "package main
+$SWITCH
+func main() int { return f(0) }"
+assert 20 "package main
+$SWITCH
+func main() int { return f(2) }"
+assert 50 "package main
+$SWITCH
+func main() int { return f(5) }"
+assert 99 "package main
+$SWITCH
+func main() int { return f(4) }"
+assert 99 "package main
+$SWITCH
+func main() int { return f(0-1) }"
+assert 3 'package main
+func main() int {
+	n := 0
+	switch n + 1 {
+	case 3:
+		n = 1
+	case 1, 2:
+		n = 3
+	}
+	return n
+}'
+assert 11 'package main
+func main() int {
+	n := 0
+	switch y := 1; {
+	case y < 4:
+		n = 1
+		fallthrough
+	case y < 8:
+		n = n + 10
+	case y == 8:
+		n = 20
+	}
+	return n
+}'
+assert 7 'package main
+func main() int {
+	switch x := 2; x {
+	default:
+		return 7
+	case 1:
+		return 1
+	}
+	return 0
+}'
+assert 4 'package main
+func main() int {
+	n := 0
+	for i := 0; i < 6; i = i + 1 {
+		switch i {
+		case 2:
+			continue
+		case 4:
+			break
+		default:
+			n = n + 1
+		}
+	}
+	return n
+}'
+assert 2 'package main
+func main() int {
+	n := 0
+L:
+	for {
+		switch {
+		case n == 2:
+			break L
+		}
+		n = n + 1
+	}
+	return n
+}'
+assert_error 'tmp.go:1:52: 最後の節ではfallthroughを使えません' 'package main; func main() int { switch 1 { case 1: fallthrough }; return 0 }'
+assert_error 'tmp.go:1:62: fallthroughはここでは使えません' 'package main; func main() int { switch 1 { case 1: if true { fallthrough }; case 2: }; return 0 }'
+assert_error 'tmp.go:1:49: 型が一致しません: int と bool' 'package main; func main() int { switch 1 { case true: }; return 0 }'
+assert_error 'tmp.go:1:47: 条件式がbool型ではありません: int' 'package main; func main() int { switch { case 1: }; return 0 }'
+assert_error 'tmp.go:1:55: caseの値が重複しています: 1' 'package main; func main() int { switch 1 { case 1, 2, 1: }; return 0 }'
+assert_error 'tmp.go:1:55: defaultが複数あります' 'package main; func main() int { switch 1 { default: ; default: }; return 0 }'
+assert_error 'tmp.go:1:44: caseまたはdefaultではありません' 'package main; func main() int { switch 1 { x := 1 }; return 0 }'
+assert_error 'tmp.go:1:54: continueの対象にできないラベルです: L' 'package main; func main() int { L: switch { default: continue L }; return 0 }'
+
+assert 2 'package main; func main() int { return 17 % 5 }'
+assert 8 'package main; func main() int { return 0-17 % 5 + 10 }'
+assert 8 'package main; func main() int { return 12 & 10 }'
+assert 15 'package main; func main() int { return 12 | 3 }'
+assert 6 'package main; func main() int { return 12 ^ 10 }'
+assert 10 'package main; func main() int { return 15 &^ 5 }'
+assert 16 'package main; func main() int { return 1 << 4 }'
+assert 16 'package main; func main() int { return 64 >> 2 }'
+assert 4 'package main; func main() int { return ^5 + 10 }'
+assert 6 'package main; func main() int { return 2 + 3 * 4 & 5 }'
+assert 15 'package main; func main() int { return 1 + 6 | 8 }'
+assert 5 'package main; func main() int { return 1 << 2 + 1 }'
+assert 1 "package main; $B2I
+func main() int { x := 64; return b2i(1 << x == 0) }"
+assert 1 "package main; $B2I
+func main() int { x := 70; return b2i((0-8) >> x == 0-1) }"
+assert 1 "package main; $B2I
+func main() int { return b2i(!false) }"
+assert 1 "package main; $B2I
+func main() int { return b2i(1 < 2 && 3 < 2 || 2 == 2) }"
+assert 0 "package main; $B2I
+func main() int { return b2i(1 < 2 && (3 < 2 || 2 != 2)) }"
+SIDE='func side(p *int) bool { *p = *p + 1; return true }'
+assert 0 "package main; $SIDE
+func main() int { n := 0; if false && side(&n) { n = 10 }; return n }"
+assert 5 "package main; $SIDE
+func main() int { n := 0; if true || side(&n) { n = n + 5 }; return n }"
+assert 6 "package main; $SIDE
+func main() int { n := 0; if true && side(&n) { n = n + 5 }; return n }"
+assert_error 'tmp.go:1:38: 型が一致しません: int と bool' 'package main; func main() int { if 1 && true { return 1 }; return 0 }'
+assert_error 'tmp.go:1:36: 演算子!はint型に使えません' 'package main; func main() int { if !1 { return 1 }; return 0 }'
+assert_error 'tmp.go:1:40: 演算子^はbool型に使えません' 'package main; func main() int { return ^true }'
+assert_error 'tmp.go:1:45: シフト数が整数ではありません: bool' 'package main; func main() int { return 1 << true }'
+assert_error 'tmp.go:1:47: 型が一致しません: bool と int' 'package main; func main() int { return 1 == 2 < 3 }'
+
+assert 4 'package main; func main() int { x := 5; x += 3; x -= 1; x *= 4; x /= 2; x %= 5; return x }'
+assert 20 'package main; func main() int { x := 12; x &= 10; x |= 1; x ^= 3; x <<= 2; x >>= 1; x &^= 2; return x }'
+assert 9 'package main
+func main() int {
+	x := 0
+	for i := 0; i < 10; i++ {
+		x++
+	}
+	x--
+	return x
+}'
+assert 17 'package main
+func inc(p *int) *int { *p = *p + 1; return p }
+func main() int {
+	n := 0
+	y := 1
+	*inc(&n) += 10
+	*inc(&y) *= 3
+	return n + y
+}'
+assert 3 'package main; func main() int { n := 0; p := &n; *p++; *p += 2; return n }'
+assert_error 'tmp.go:1:45: 条件式ではありません' 'package main; func main() int { x := 1; if x++ { }; return x }'
+assert_error 'tmp.go:1:33: 代入できません' 'package main; func main() int { 1 += 2; return 0 }'
+assert_error 'tmp.go:1:46: 型が一致しません: bool と int' 'package main; func main() int { x := true; x += 1; return 0 }'
+assert_error "tmp.go:1:49: 'Reserved word: ;'ではありません" 'package main; func main() int { x := 1; return x++ }'
+
+assert 21 'package main; func main() int { a := 1; b := 2; a, b = b, a; return a*10 + b }'
+assert 56 'package main; func main() int { a := 1; b := 2; c := 3; a, b, c = c, a, b; return a*10*10 + b*10 + c }'
+assert 2 'package main; func main() int { x := 0; x, x = 1, 2; return x }'
+assert 53 'package main; func main() int { n := 3; p := &n; m := 0; *p, m = 5, n; return n*10 + m }'
+INCR='func incr(p *int) int { *p = *p + 1; return *p }'
+assert 1 "package main; $INCR
+func main() int { n := 0; _ = incr(&n); return n }"
+assert 7 "package main; $INCR
+func main() int { n := 0; _, n = incr(&n), 7; return n }"
+assert_error 'tmp.go:1:54: 代入の左辺と右辺の数が一致しません: 2 と 1' 'package main; func main() int { a := 1; b := 1; a, b = 1; return a }'
+assert_error 'tmp.go:1:38: _は値として使えません' 'package main; func main() int { a := _; return a }'
+assert_error 'tmp.go:1:46: 条件式ではありません' 'package main; func main() int { a := 1; if a = 2 { }; return a }'
+assert_error 'tmp.go:1:44: 代入できません' 'package main; func main() int { a := 1; a, 1 = 2, 3; return a }'
+
+assert 77 'package main
+func divmod(a, b int) (int, int) {
+	return a / b, a % b
+}
+func named(x int) (q, r int, ok bool) {
+	if x < 0 {
+		return
+	}
+	q = x * 2
+	r = x + 1
+	ok = true
+	return
+}
+func fwd(a int) (int, int) {
+	return divmod(a, 3)
+}
+func single() (n int) {
+	n = 9
+	return
+}
+func main() int {
+	q, r := divmod(17, 5)
+	a, b, ok := named(4)
+	_, _, ok2 := named(0 - 1)
+	c, d := fwd(10)
+	var e, f = divmod(9, 2)
+	x, y := 1, 2
+	x, y = y, x
+	q, z := 40, 1
+	divmod(1, 1)
+	if !ok || ok2 {
+		return 1
+	}
+	return q + r + a + b + c + d + e + f + x + y + single() + z
+}'
+TWO='func two() (int, int) { return 1, 2 }'
+assert_error 'tmp.go:2:26: 複数の値を1つの値として使えません: (int, int)' "package main; $TWO
+func main() int { return two() }"
+assert_error 'tmp.go:2:19: 代入の左辺と右辺の数が一致しません: 3 と 2' "package main; $TWO
+func main() int { a, b, c := two(); return a }"
+assert_error 'tmp.go:3:26: 引数が足りません' "package main; $TWO
+func h(a, b, c int) int { return a }
+func main() int { return h(two()) }"
+assert_error 'tmp.go:3:28: 複数の値を1つの値として使えません: (int, int)' "package main; $TWO
+func h(a, b int) int { return a }
+func main() int { return h(two(), 3) }"
+assert_error 'tmp.go:3:28: int型の値をbool型として使えません' "package main; $TWO
+func h(a int, b bool) int { return a }
+func main() int { return h(two()) }"
+assert_error 'tmp.go:1:37: 戻り値が足りません' 'package main; func f() (int, int) { return 1 }; func main() int { return 0 }'
+assert_error 'tmp.go:1:37: 戻り値が多すぎます' 'package main; func f() (int, int) { return 1, 2, 3 }; func main() int { return 0 }'
+assert_error 'tmp.go:1:48: int型の値をbool型として使えません' 'package main; func f() (int, bool) { return 1, 2 }; func main() int { return 0 }'
+assert_error 'tmp.go:1:36: 名前付きの戻り値と名前のない戻り値が混在しています' 'package main; func f() (a int, bool) { return }; func main() int { return 0 }'
+assert_error 'tmp.go:1:43: :=の左辺に新しい変数がありません' 'package main; func main() int { a := 1; a := 2; return a }'
+assert_error 'tmp.go:1:36: aが:=の左辺で繰り返されています' 'package main; func main() int { a, a := 1, 2; return a }'
+
+assert 116 'package main
+func sum8(a, b, c, d, e, f, g, h int) int {
+	return a + b*2 + c*3 + d*4 + e*5 + f*6 + g*7 + h*8
+}
+func sub9(a, b, c, d, e, f, g, h, i int) int {
+	return i - h - g
+}
+func pair(a, b, c, d, e, f int) (int, int) {
+	return a + b + c, d + e + f
+}
+func main() int {
+	x, y := pair(1, 2, 3, 4, 5, 6)
+	return sum8(1, 1, 1, 1, 1, 1, 1, sum8(0, 0, 0, 0, 0, 0, 0, 1)) + sub9(0, 0, 0, 0, 0, 0, 3, 4, 10) + x + y
+}'
+
+MANY='package main
+func many(a, b, c, d, e, f, g, h, i, j, k int) (int, int, int, int, int, int, int, int, int, int, int) {
+	return k, j, i, h, g, f, e, d, c, b, a
+}
+func fwd(a int) (int, int, int, int, int, int, int, int, int, int, int) {
+	return many(a, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11)
+}
+func main() int {
+	a, b, _, _, _, _, _, _, _, j, k := many(1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11)
+	_, _, _, _, _, _, _, _, _, _, z := fwd(40)
+	return a*1 + b*2 + j*3 + k*4 + z
+}'
+assert 81 "$MANY"
+assert 81 "$MANY" -abi internal
+assert 42 'package main
+func sum(a, b, c int) int { return a + b + c }
+func pair(a, b int) (int, int) { return b, a }
+func main() int {
+	x, y := pair(sum(1, 2, 3), 36)
+	return x + y
+}' -abi internal
+assert_error 'foo: unknown ABI' 'package main; func main() int { return 0 }' -abi foo
+
+assert 5 'package main; func main() int { return len("hello") }'
+assert 4 'package main; func main() int { return len(`a\nb`) }'
+assert 11 'package main; func main() int { return len("a\tb\x41\101é\U0001F600") }'
+assert 0 'package main; func main() int { var s string; return len(s) }'
+assert 1 "package main; $B2I
+"'func main() int { var s string; return b2i(s == "") }'
+assert 1 "package main; $B2I
+"'func main() int { s := "hello"; return b2i(s[1] == "xe"[1]) }'
+assert 0 "package main; $B2I
+"'func main() int { s := "hello"; return b2i(s[0] == s[4]) }'
+assert 1 "package main; $B2I
+"'func main() int { return b2i("\xff"[0] + "\x01"[0] == "\x00"[0]) }'
+assert 63 "package main; $B2I
+"'func main() int {
+	return b2i("abc" < "abd") + 2*b2i("ab" < "abc") + 4*b2i("b" > "abc") + 8*b2i("abc" == "abc") + 16*b2i("abc" != "abd") + 32*b2i("" < "a")
+}'
+assert 0 "package main; $B2I
+"'func main() int { return b2i("abc" < "abc") + b2i("abd" <= "abc") + b2i("a" == "b") }'
+assert 19 "package main; $B2I
+"'func main() int {
+	s := "foo" + "bar"
+	s += "baz"
+	return len(s) + 10*b2i(s == "foobarbaz")
+}'
+assert 7 'package main; func malloc(n int) int { return 0 }; func main() int { a := "ab"; s := a + "cde"; s += "fg"; return len(s) + malloc(1) + int(s[6]) - 103 }'
+assert 7 'package main; func malloc(n int) int { return 0 }; func main() int { a := "ab"; s := a + "cde"; s += "fg"; return len(s) + malloc(1) + int(s[6]) - 103 }' -abi internal
+assert 3 'package main; func main() int { s := "x"; p := &s; *p = "abc"; return len(s) }'
+assert 21 'package main; func main() int { a, b := "x", "yy"; a, b = b, a; return len(a)*10 + len(b) }'
+assert 2 'package main; func main() int { s := "ab"; i := 2; if s[i] == s[0] { return 1 }; return 0 }'
+STRFN='package main
+func greet(name string) string { return "hi, " + name }
+func split() (string, int, string) { return "ab", 3, "cde" }
+func fwd() (string, int, string) { return split() }
+func lens(a, b, c, d, e string) int { return len(a) + 2*len(b) + 3*len(c) + 4*len(d) + 5*len(e) }
+func main() int {
+	x, n, y := fwd()
+	if greet("went") != "hi, went" {
+		return 1
+	}
+	return len(x) + n*10 + len(y) + lens("a", "", "", "", "bb")
+}'
+assert 46 "$STRFN"
+assert 46 "$STRFN" -abi internal
+FWDFN='package main
+type P struct{ x, y int }
+func g() (int, int) { return 3, 4 }
+func h(a, b int) int { return a*10 + b }
+func sp() (string, P, byte) { return "abc", P{5, 6}, byte(7) }
+func use(s string, p P, b byte) int { return len(s) + p.x*10 + p.y*100 + int(b)*1000 }
+func many() (int, int, int, int, int, int, int) { return 1, 2, 3, 4, 5, 6, 7 }
+func sum(a, b, c, d, e, f, g int) int { return a + b + c + d + e + f + g*100 }
+func main() int {
+	return h(g()) + use(sp()) + sum(many()) + h(h(g()), 1)
+}'
+assert 45 "$FWDFN"
+assert 45 "$FWDFN" -abi internal
+assert 14 'package main
+func f(s string) int {
+	switch s {
+	case "a":
+		return 1
+	case "bc", "de":
+		return 2
+	}
+	return 3
+}
+func main() int { return f("a") + f("de")*2 + f("b")*3 }'
+assert_error '文字列が閉じられていません' 'package main; func main() int { s := "abc; return 0 }'
+assert_error '不正なエスケープシーケンスです' 'package main; func main() int { s := "a\qb"; return 0 }'
+assert_error '不正なエスケープシーケンスです' 'package main; func main() int { s := "\400"; return 0 }'
+assert_error '型が一致しません: string と int' 'package main; func main() int { s := "a" + 1; return 0 }'
+assert_error 'lenにint型の値は使えません' 'package main; func main() int { return len(1) }'
+assert_error '引数が足りません' 'package main; func main() int { return len() }'
+assert_error '引数が多すぎます' 'package main; func main() int { return len("a", "b") }'
+assert_error '引数が足りません' 'package main; func main() int { n := len(); return n }' -errlimit 0
+assert_error '代入できません' 'package main; func main() int { s := "ab"; s[0] = s[1]; return 0 }'
+assert_error '添字が整数ではありません: string' 'package main; func main() int { s := "ab"; return len(s[s]) }'
+assert_error '演算子-はstring型に使えません' 'package main; func main() int { s := "a" - "b"; return 0 }'
+
+assert 97 "package main; func main() int { return int('a') }"
+assert 10 "package main; func main() int { return int('\n') }"
+assert 33 "package main; func main() int { return int('é' - 'È') }"
+assert 65 "package main; func main() int { return int('\x41') }"
+assert 39 "package main; func main() int { return int('\'') + int('\u0000') }"
+assert 4 'package main; func main() int { b := byte(25*10); return int(b + byte(10)) }'
+assert 44 'package main; func main() int { n := 30*10; return int(byte(n)) }'
+assert 255 'package main; func main() int { return int(rune(-1)) }'
+assert 1 "package main; $B2I
+"'func main() int { n := 1; return b2i(int(rune(n << 31)) < 0) }'
+assert 7 'package main; func main() int {
+	var a byte
+	var b rune
+	c := 7
+	a = byte(c * 40)
+	b = rune(a) - rune(c)
+	if a != byte(24) || b != rune(17) {
+		return 1
+	}
+	return c
+}'
+assert 3 "package main
+func count(s string) int {
+	n := 0
+	for i := 0; i < len(s); i++ {
+		switch rune(s[i]) {
+		case 'a', 'e', 'i', 'o', 'u':
+			n++
+		}
+	}
+	return n
+}
+func main() int { return count(\"went is a compiler\") - 3 }"
+RUNEFN="package main
+func next(b byte) rune { return rune(b) + rune(1) }
+func split(s string) (byte, rune, int) { return s[0], next(s[1]), len(s) }
+func main() int {
+	x, y, n := split(\"ab\")
+	var z uint8 = x
+	var w int32 = y
+	return int(z) - int('a') + int(w) - int('c') + n
+}"
+assert 2 "$RUNEFN"
+assert 2 "$RUNEFN" -abi internal
+assert_error '空のルーンリテラルです' "package main; func main() int { return int('') }"
+assert_error 'ルーンリテラルが閉じられていません' "package main; func main() int { return int('ab') }"
+assert_error '不正なエスケープシーケンスです' "package main; func main() int { return int('\\\"') }"
+assert_error 'string型の値をint型に変換できません' 'package main; func main() int { return int("a") }'
+assert_error '型が一致しません: byte と rune' "package main; func main() int { s := \"a\"; if s[0] == rune('a') { return 1 }; return 0 }"
+
+assert 3 'package main; func main() int { var a [3]int; return len(a) }'
+assert 0 'package main; func main() int { var a [3]int; return a[0] + a[1] + a[2] }'
+assert 6 'package main; func main() int { a := [3]int{1, 2, 3}; return a[0] + a[1] + a[2] }'
+assert 5 'package main; func main() int { a := [...]int{1, 2, 3, 4, 5}; return len(a) }'
+assert 2 'package main; func main() int { a := [4]int{1, 2}; return a[1] + a[2] + a[3] }'
+assert 10 'package main; func main() int {
+	var a [5]int
+	for i := 0; i < len(a); i++ {
+		a[i] = i
+	}
+	return a[0] + a[1] + a[2] + a[3] + a[4]
+}'
+assert 13 'package main; func main() int { a := [2]int{3, 4}; b := a; b[0] = 10; return a[0] + b[0] + b[1] - a[1] }'
+assert 9 'package main; func main() int { a := [2][2]int{{1, 2}, {3, 4}}; a[1][0] += 2; return a[1][0] + a[1][1] }'
+assert 7 'package main; func main() int { a := [3]int{1, 2, 3}; p := &a[1]; *p = 5; q := &a; q[2]--; return a[1] + q[2] }'
+assert 3 'package main; func main() int { a := [3]byte{byte(1), byte(2)}; a[2] = a[0] + a[1]; return int(a[2]) }'
+assert 21 'package main; func main() int { a, b := [2]int{1, 2}, [2]int{20, 10}; a, b = b, a; return a[0] + b[0] }'
+assert 2 'package main; func main() int { a := [2]int{1, 2}; i := 2; return a[i] }'
+ARRFN='package main
+func sum(a [4]int) int {
+	a[0] = 0
+	return a[0] + a[1] + a[2] + a[3]
+}
+func rev(a [3]byte) [3]byte { return [3]byte{a[2], a[1], a[0]} }
+func one(a [1]int, s [2]string) (int, [2]string, int) { return a[0], s, len(s[1]) }
+func main() int {
+	a := [4]int{10, 1, 2, 3}
+	b := rev([3]byte{byte(1), byte(2), byte(3)})
+	x, s, n := one([1]int{4}, [2]string{"a", "bcd"})
+	return sum(a) + a[0] + int(b[0])*10 + x + len(s[0]) + n
+}'
+assert 54 "$ARRFN"
+assert 54 "$ARRFN" -abi internal
+assert_error '添字が範囲外です: 3 (長さ3)' 'package main; func main() int { var a [3]int; return a[3] }'
+assert_error '配列の要素が多すぎます: 2個まで' 'package main; func main() int { a := [2]int{1, 2, 3}; return a[0] }'
+assert_error '[2]int型の値を[3]int型として使えません' 'package main; func main() int { var a [3]int; a = [2]int{1, 2}; return a[0] }'
+assert_error '演算子==は[2]int型に使えません' 'package main; func main() int { a := [2]int{}; if a == a { return 1 }; return 0 }'
+assert_error 'string型の値をint型として使えません' 'package main; func main() int { a := [2]int{"a"}; return a[0] }'
+
+assert 0 'package main; func main() int { var s []int; return len(s) + cap(s) }'
+assert 35 'package main; func main() int { s := make([]int, 3, 5); return len(s)*10 + cap(s) }'
+assert 33 'package main; func main() int { s := make([]int, 3); return len(s)*10 + cap(s) + s[0] + s[2] }'
+assert 7 'package main; func main() int { s := make([]int, 2); s[1] = 7; return s[0] + s[1] }'
+assert 45 'package main; func main() int {
+	var s []int
+	for i := 0; i < 10; i++ {
+		s = append(s, i)
+	}
+	sum := 0
+	for i := 0; i < len(s); i++ {
+		sum += s[i]
+	}
+	return sum
+}'
+assert 16 'package main; func main() int { var s []int; for i := 0; i < 9; i++ { s = append(s, i) }; return cap(s) }'
+assert 6 'package main; func main() int { s := append([]int{1}, 2, 3); return s[0] + s[1] + s[2] }'
+assert 15 'package main; func main() int { s := []int{1, 2}; t := []int{3, 4, 5}; s = append(s, t...); return s[0] + s[1] + s[2] + s[3] + s[4] }'
+assert 108 'package main; func main() int { b := append(make([]byte, 3), "bc"...); return len(b)*2 + int(b[3]) }'
+assert 23 'package main; func main() int { a := [5]int{1, 2, 3, 4, 5}; s := a[1:3]; return len(s)*10 + s[1] }'
+assert 43 'package main; func main() int { a := [5]int{1, 2, 3, 4, 5}; s := a[1:3]; return cap(s)*10 + s[:4][3] - 2 }'
+assert 27 'package main; func main() int { a := [5]int{1, 2, 3, 4, 5}; s := a[1:3:4]; s[0] = 9; return cap(s)*10 + a[1] - len(s)*6 }'
+assert 12 'package main; func main() int { a := [3]int{1, 2, 3}; p := &a; s := p[:]; t := s[1:]; return len(s)*3 + t[1] }'
+assert 3 'package main; func main() int { s := "hello"[1:4]; return len(s) }'
+assert 108 'package main; func main() int { s := "hello"; return int(s[2:][1]) }'
+assert 2 'package main; func main() int { s := []int{1, 2}; i := 3; return len(s[:i]) }'
+assert 2 'package main; func main() int { s := make([]int, 2); n := 3; s = make([]int, n, 1); return len(s) }'
+assert 2 'package main; func main() int { s := []int{1, 2}; i := 2; return s[i] }'
+assert 23 'package main; func main() int { s := []int{1, 2, 3}; t := make([]int, 2); n := copy(t, s); return n*10 + t[0] + t[1] }'
+assert 32 'package main; func main() int { s := []int{1, 2, 3}; copy(s[1:], s); return s[0]*25 + s[1]*5 + s[2] }'
+assert 3 'package main; func main() int { b := make([]byte, 5); return copy(b, "abc") }'
+assert 10 'package main; func main() int { s := [][]int{{1, 2}, {3}, {}}; return s[0][0] + s[0][1] + s[1][0] + len(s)*10/3 - 6 + len(s[2]) }'
+assert 6 'package main; func main() int { s := []string{"a", "bc", "def"}; return len(s[0]) + len(s[1]) + len(s[2]) }'
+assert 9 'package main; func main() int { s := []int{1, 2}; t := s; t[0] = 7; return s[0] + s[1] }'
+SLICEFN='package main
+func fill(s []int, v int) {
+	for i := 0; i < len(s); i++ {
+		s[i] = v
+	}
+}
+func push(s []int, v int) []int { return append(s, v) }
+func pair(s []int) ([]int, int, []int) { return s[:1], len(s), s[1:] }
+func main() int {
+	s := make([]int, 3)
+	fill(s[1:], 4)
+	s = push(s, 5)
+	a, n, b := pair(s)
+	return a[0] + s[1] + s[3] + n*10 + len(b)
+}'
+assert 52 "$SLICEFN"
+assert 52 "$SLICEFN" -abi internal
+assert_error 'appendの最初の引数がスライスではありません: int' 'package main; func main() int { return len(append(1, 2)) }'
+assert_error 'int型の値を[]int型として使えません' 'package main; func main() int { s := []int{}; s = append(s, 1)[0]; return 0 }'
+assert_error 'string型の値をint型として使えません' 'package main; func main() int { s := append([]int{}, "a"); return len(s) }'
+assert_error '[]byte型の値の要素を[]int型に複製できません' 'package main; func main() int { return copy([]int{}, []byte{}) }'
+assert_error 'makeで作れない型です: int' 'package main; func main() int { return make(int, 1) }'
+assert_error 'lenがcapより大きいです: 3 > 2' 'package main; func main() int { return len(make([]int, 3, 2)) }'
+assert_error '文字列のスライス式に3つの添字は使えません' 'package main; func main() int { return len("abc"[0:1:2]) }'
+assert_error '3つの添字を持つスライス式では3つ目の添字を省略できません' 'package main; func main() int { s := []int{}; return len(s[0:1:]) }'
+assert_error 'capにstring型の値は使えません' 'package main; func main() int { return cap("a") }'
+assert_error '引数が足りません' 'package main; func main() int { return cap() }'
+assert_error '引数が多すぎます' 'package main; func main() int { s := []int{1}; return cap(s, s) }'
+assert_error '引数が足りません' 'package main; func main() int { return copy() }'
+assert_error '引数が足りません' 'package main; func main() int { s := []int{1}; return copy(s) }'
+assert_error '引数が多すぎます' 'package main; func main() int { s := []int{1}; return copy(s, s, s) }'
+assert_error '引数が足りません' 'package main; func main() int { return len(append()) }'
+assert_error '引数が足りません' 'package main; func main() int { return len(make([]int)) }'
+assert_error '引数が足りません' 'package main; func main() int { s := []int{1}; n := copy(s); return n + cap() }' -errlimit 0
+assert_error '演算子==は[]int型に使えません' 'package main; func main() int { s := []int{}; if s == s { return 1 }; return 0 }'
+assert 3 'package main; func main() int { var s []int; t := []int{}; r := 0; if s == nil { r++ }; if nil != t { r += 2 }; return r }'
+assert 5 'package main; func f() []int { return nil }; func main() int { var x []int = nil; x = append(x, 5); if f() == nil { return x[0] }; return 0 }'
+assert 5 'package main; func f() []int { return nil }; func main() int { var x []int = nil; x = append(x, 5); if f() == nil { return x[0] }; return 0 }' -abi internal
+assert 2 'package main; func main() int { a, b := []int{1}, []int{2}; a, b = nil, a; return len(a) + len(b) + cap(b) }'
+assert_error '型のないnilは使えません' 'package main; func main() int { x := nil; return 0 }'
+assert_error '型のないnilは使えません' 'package main; func main() int { _ = nil; return 0 }'
+assert_error 'nilをint型として使えません' 'package main; func main() int { return nil }'
+assert_error '演算子==はuntyped nil型に使えません' 'package main; func main() int { if nil == nil { return 1 }; return 0 }'
+assert_error '型が一致しません: []int と int' 'package main; func main() int { var s []int; if s == 0 { return 1 }; return 0 }'
+assert_error '可変長引数の関数ではありません: f' 'package main; func f(a int) int { return a }; func main() int { s := []int{1}; return f(s...) }'
+assert 5 'package main; func calloc(n, m int) int { return 0 }; func memmove(a, b, n int) int { return 0 }; func main() int { s := make([]int, 2); s = append(s, 3); copy(s, []int{2}); return s[0] + s[2] + calloc(1, 1) }'
+assert 5 'package main; func calloc(n, m int) int { return 0 }; func memmove(a, b, n int) int { return 0 }; func main() int { s := make([]int, 2); s = append(s, 3); copy(s, []int{2}); return s[0] + s[2] + calloc(1, 1) }' -abi internal
+
+assert 3 'package main; type P struct { x, y int }; func main() int { var p P; p.x = 1; p.y = 2; return p.x + p.y }'
+assert 0 'package main; type P struct { x int; s string }; func main() int { var p P; return p.x + len(p.s) }'
+assert 7 'package main; type P struct { x, y int }; func main() int { p := P{3, 4}; return p.x + p.y }'
+assert 4 'package main; type P struct { x, y int }; func main() int { p := P{y: 4}; return p.x + p.y }'
+assert 13 'package main; type P struct { x, y int }; func main() int { p := P{1, 2}; q := p; q.x = 10; return p.x + q.x + p.y }'
+assert 9 'package main; type P struct { x, y int }; func main() int { p := P{1, 2}; r := &p; r.y = 8; return p.x + p.y }'
+assert 6 'package main; type P struct { x, y int }; func main() int { p := P{1, 2}; r := &p.y; *r += 3; p.x++; return p.x + p.y - 1 }'
+assert 21 'package main
+type B struct {
+	a byte
+	n int
+	c byte
+	r rune
+}
+func main() int {
+	b := B{a: byte(1), n: 2, c: byte(3), r: rune(4)}
+	b.c += byte(10)
+	return int(b.a) + b.n + int(b.c) + int(b.r) + 1
+}'
+assert 10 'package main
+type P struct { x, y int }
+type R struct {
+	min, max P
+}
+func main() int {
+	r := R{P{1, 2}, P{4, 6}}
+	r.max.x++
+	return (r.max.x - r.min.x) * (r.max.y - r.min.y) / 2 + 2
+}'
+assert 7 'package main
+type N struct {
+	val  int
+	next *N
+}
+func main() int {
+	a := N{val: 3}
+	b := N{4, &a}
+	return b.val + b.next.val + len([]N{}) * 0
+}'
+assert 11 'package main; type P struct { x, y int }; func main() int { ps := []P{{1, 2}, {y: 8}}; a := [2]P{}; a[1].x = 1; return ps[0].x + ps[1].y + a[1].x + a[0].y + len(ps) - 1 }'
+assert 5 'package main; type P struct { x, y int }; func main() int { if p := (P{2, 3}); p.x < p.y { return p.x + p.y }; return 0 }'
+assert 3 'package main; type P struct { x int }; func main() int { n := 0; for i := 0; i < (P{3}).x; i++ { n++ }; return n }'
+assert 2 'package main; type P struct { x int }; func main() int { switch p := (P{2}); p.x { case 2: return 2 }; return 0 }'
+assert 5 'package main; type P struct { x, y int }; func main() int { a, b := P{1, 2}, P{3, 4}; a, b = b, a; return a.x + b.y - 1 + b.x + a.y - 4 }'
+assert_asm '.zero 3' 'package main; type T struct { a, b bool; c byte }; var t T; func main() int { return 0 }'
+assert_asm '.zero 32' 'package main; type T struct { a, b bool; c byte; n int }; var t [2]T; func main() int { return 0 }'
+assert_asm '.zero 24' 'package main; type T struct { a bool; n int; b bool }; var t T; func main() int { return 0 }'
+BOOLFN='package main
+type T struct {
+	a, b bool
+	c    byte
+	n    int
+}
+type U struct {
+	ok bool
+	t  T
+	f  [3]bool
+}
+func get(t T, x bool) T {
+	t.b = t.a && x
+	t.n += int(t.c)
+	return t
+}
+func main() int {
+	u := U{ok: true}
+	u.t = get(T{true, false, 3, 4}, u.ok)
+	u.f[1] = u.t.b
+	r := u.t.n * 10
+	if u.f[1] && !u.f[0] && !u.f[2] {
+		r++
+	}
+	return r
+}'
+assert 71 "$BOOLFN"
+assert 71 "$BOOLFN" -abi internal
+STRUCTFN='package main
+type P struct {
+	x, y int
+}
+type S struct {
+	a, b byte
+}
+func swap(p P) P {
+	p.x, p.y = p.y, p.x
+	return p
+}
+func scale(p *P, n int) {
+	p.x *= n
+	p.y *= n
+}
+func pair(s S, p P, name string) (S, int, P) {
+	return S{s.b, s.a}, len(name), p
+}
+func main() int {
+	p := P{1, 2}
+	q := swap(p)
+	scale(&q, 3)
+	s, n, r := pair(S{byte(4), byte(5)}, q, "abc")
+	return p.x*10 + q.x + int(s.a)*2 + n + r.y - swap(p).x
+}'
+assert 30 "$STRUCTFN"
+assert 30 "$STRUCTFN" -abi internal
+assert_error '未定義の型です: Q' 'package main; type P struct { q Q }; func main() int { return 0 }'
+assert_error '不正な再帰型です: P' 'package main; type P struct { p P }; func main() int { return 0 }'
+assert_error 'フィールドxは既に宣言されています' 'package main; type P struct { x, x int }; func main() int { return 0 }'
+assert_error 'Pは既に宣言されています' 'package main; type P struct { x int }; type P struct { y int }; func main() int { return 0 }'
+assert_error 'P型にフィールドzはありません' 'package main; type P struct { x int }; func main() int { var p P; return p.z }'
+assert_error 'int型の値にフィールドはありません' 'package main; func main() int { n := 1; return n.x }'
+assert_error 'P型にフィールドzはありません' 'package main; type P struct { x int }; func main() int { p := P{z: 1}; return p.x }'
+assert_error 'フィールドxが重複しています' 'package main; type P struct { x int }; func main() int { p := P{x: 1, x: 2}; return p.x }'
+assert_error 'フィールド名の付いた要素と付いていない要素を混ぜられません' 'package main; type P struct { x, y int }; func main() int { p := P{x: 1, 2}; return p.x }'
+assert_error '構造体の要素が足りません: 2個必要です' 'package main; type P struct { x, y int }; func main() int { p := P{1}; return p.x }'
+assert_error '構造体の要素が多すぎます: 2個まで' 'package main; type P struct { x, y int }; func main() int { p := P{1, 2, 3}; return p.x }'
+assert_error 'string型の値をint型として使えません' 'package main; type P struct { x int }; func main() int { p := P{"a"}; return p.x }'
+assert_error 'Q型の値をP型として使えません' 'package main; type P struct { x int }; type Q struct { x int }; func main() int { var p P; p = Q{1}; return p.x }'
+assert_error '演算子==はP型に使えません' 'package main; type P struct { x int }; func main() int { p := P{1}; if p == p { return 1 }; return 0 }'
+assert_error '代入できません' 'package main; type P struct { x int }; func f() P { return P{1} }; func main() int { f().x = 2; return 0 }'
+assert 3 'package main; type P struct { x int }; func main() int { p := &P{x: 1}; p.x += 2; return p.x }'
+assert 81 'package main; type P struct { x int }; func main() int { s := []*P{{x: 1}, &P{2}, {3}}; return s[0].x + s[1].x*10 + s[2].x*20 }'
+assert 7 'package main; func main() int { p := &[3]int{1, 2, 3}; q := &[3]int{4, 5, 6}; return p[2] + q[0] }'
+LISTFN='package main
+type Node struct { next *Node; v int }
+func NewNode(v int, next *Node) *Node { return &Node{next: next, v: v} }
+func main() int {
+	var head *Node
+	for i := 1; i <= 4; i++ {
+		head = NewNode(i, head)
+	}
+	n := 0
+	for p := head; p != nil; p = p.next {
+		n = n*10 + p.v
+	}
+	return n % 256
+}'
+assert 225 "$LISTFN"
+assert 225 "$LISTFN" -abi internal
+assert 3 'package main; type P struct { x int }; func find(s []*P, x int) *P { for i := 0; i < len(s); i++ { if s[i].x == x { return s[i] } }; return nil }; func main() int { s := []*P{{1}, {2}, {3}}; if find(s, 4) == nil { return find(s, 3).x }; return 0 }'
+assert 3 'package main; type P struct { x int }; func find(s []*P, x int) *P { for i := 0; i < len(s); i++ { if s[i].x == x { return s[i] } }; return nil }; func main() int { s := []*P{{1}, {2}, {3}}; if find(s, 4) == nil { return find(s, 3).x }; return 0 }' -abi internal
+assert 1 'package main; func main() int { var p *int; q := &[]int{1}[0]; if p == nil && q != nil { return *q }; return 0 }'
+assert_error '演算子<は*int型に使えません' 'package main; func main() int { var p *int; if p < nil { return 1 }; return 0 }'
+assert_error '代入できません' 'package main; type P struct { x int }; func main() int { P{1}.x = 2; return 0 }'
+assert 7 'package main; func main() int { var p P; p.x = 3; q := P{x: 4}; return p.x + q.x }; type P struct { x int }'
+assert 3 'package main; type A struct { b *B; n int }; type B struct { a *A; m int }; func main() int { a := A{n: 1}; b := B{a: &a, m: 2}; a.b = &b; return a.b.m + b.a.n }'
+assert 7 'package main; type A struct { x B }; type B struct { y int }; func main() int { a := A{B{7}}; return a.x.y }'
+assert 5 'package main; func f(c C) C { return c + 1 }; type C int; func main() int { return int(f(C(4))) }'
+assert_error '不正な再帰型です: B' 'package main; type A struct { b B }; type B struct { a A }; func main() int { return 0 }'
+assert_error 'フィールドxは既に宣言されています' 'package main; func main() int { var b B; return 0 }; type B struct { x, x int }'
+echo 'package main; func main() int { var p P; p.x = 5; return p.x + g.y }' > tmp1.go
+echo 'package main; type P struct { x int }; var g = Q{2}; type Q struct { y int }' > tmp2.go
+assert_files 7 tmp1.go tmp2.go
+assert_files 7 tmp2.go tmp1.go
+
+assert 0 'package main; var x int; func main() int { return x }'
+assert 5 'package main; var x = 5; func main() int { return x }'
+assert 7 'package main; var x int; func set() { x = 7 }; func main() int { set(); return x }'
+assert 3 'package main; func main() int { return x + y }; var x, y = 1, 2'
+assert 9 'package main; var x = 4; func main() int { x := 5; return x + g() }; func g() int { return x }'
+assert 8 'package main; var x = 4; func main() int { p := &x; *p *= 2; return x }'
+assert 2 'package main; var b byte = byte(25*10); var r rune = rune(-4); func main() int { return int(b+byte(12)) + int(r) }'
+assert 1 'package main; var t = 2 < 3; var f bool; func main() int { if t && !f { return 1 }; return 0 }'
+assert 15 'package main; const n = 3 * 5; func main() int { return n }'
+assert 12 'package main; const a, b = c * 2, c + 1; const c = 4; func main() int { return a + b - 1 }'
+assert 4 'package main; const s = "abcd"; func main() int { return len(s) }'
+assert 9 'package main; const s = "ab" + "cd"; const t = s + "e" + s; func main() int { return len(t) }'
+assert 95 'package main; const s = "ab" + "cd"; func main() int { const t = "x" + s; var a [len(t)]int; return int(t[4]) - len(a) }'
+assert 2 'package main; const k = 2; func main() int { switch 2 { case k: return k }; return 0 }'
+assert 3 'package main; const n byte = byte(3); func main() int { var b byte = n; return int(b) }'
+assert 6 'package main; var s = "ab" + "cd"; var t = s + "ef"; func main() int { return len(t) }'
+assert 8 'package main; type P struct { x, y int }; var p = P{3, 5}; var q *P = &p; func main() int { q.x++; return p.x + p.y - 1 }'
+assert 6 'package main; var s = []int{1, 2}; func main() int { s = append(s, 3); return s[0] + s[1] + s[2] }'
+assert 5 'package main; var a [3]int; func main() int { a[1] = 5; return a[0] + a[1] + a[2] }'
+GLOBALFN='package main
+var a = b + c
+var b = f()
+var c = 3
+var d = g()
+var calls int
+func f() int {
+	calls++
+	return c * 10 + calls
+}
+func g() int {
+	calls += 10
+	return a
+}
+func main() int {
+	return a + d + calls
+}'
+assert 79 "$GLOBALFN"
+assert 79 "$GLOBALFN" -abi internal
+assert 5 'package main; var ( a = 1; b int ); func main() int { b = 4; return a + b }'
+VARGROUPFN='package main
+var (
+	x, y = 2, 3
+	s    string
+	z    = f()
+)
+func f() int { return x * 10 }
+func main() int {
+	var (
+		p = 5
+		q byte
+	)
+	var ()
+	q = 1
+	return x + y + len(s) + z + p + int(q)
+}'
+assert 31 "$VARGROUPFN"
+assert 31 "$VARGROUPFN" -abi internal
+assert_error 'aは既に宣言されています' 'package main; func main() int { var ( a = 1; a = 2 ); return a }'
+assert_error 'aは既に宣言されています' 'package main; var ( a = 1; a = 2 ); func main() int { return a }'
+assert 14 'package main; var dx, cl, mod = 2, 3, 4; var calloc = 5; func main() int { s := make([]int, 1); return dx + cl + mod + calloc + len(s) - 1 }'
+assert 14 'package main; var dx, cl, mod = 2, 3, 4; var calloc = 5; func main() int { s := make([]int, 1); return dx + cl + mod + calloc + len(s) - 1 }' -abi internal
+assert_asm '.quad 3' 'package main; var s = "abc"; func main() int { return len(s) }'
+assert_asm '.quad 6' 'package main; var a = [2]int{5, 6}; func main() int { return a[1] }'
+GLOBALDATA='package main
+type P struct {
+	a bool
+	s string
+	n int
+	r rune
+	b [3]byte
+}
+var s = "hi"
+var a = [2]int{1, 2}
+var p = P{n: 7, a: true, s: "xyz", b: [3]byte{4}}
+var q = [3]P{{true, "a", 1, 98, [3]byte{}}, {}}
+var t, u = "ab", [2]string{"c", "de"}
+var sl []int = nil
+func main() int {
+	r := len(s) + a[0] + a[1]*10
+	if p.a && p.s == "xyz" && p.n == 7 && p.b[0] == 4 && p.b[2] == 0 {
+		r += 100
+	}
+	if q[0].a && q[0].s == "a" && q[0].r == 98 && !q[1].a && q[2].n == 0 && len(q[1].s) == 0 {
+		r += 50
+	}
+	if sl == nil && t+u[0]+u[1] == "abcde" {
+		r += 20
+	}
+	return r
+}'
+assert 193 "$GLOBALDATA"
+assert 193 "$GLOBALDATA" -abi internal
+assert_error '未定義の変数です: y' 'package main; var x = y; func main() int { return x }'
+assert_error '初期化が循環しています: x' 'package main; var x = y; var y = x; func main() int { return x }'
+assert_error '初期化が循環しています: x' 'package main; var x = f(); func f() int { return x }; func main() int { return x }'
+assert_error 'xは既に宣言されています' 'package main; var x int; const x = 1; func main() int { return x }'
+assert_error 'fは既に宣言されています' 'package main; var f int; func f() int { return 0 }; func main() int { return f }'
+assert_error '定数式ではありません' 'package main; var x = 1; const c = x; func main() int { return c }'
+assert_error '定数の値がありません' 'package main; const c int; func main() int { return c }'
+assert_error '定数の名前と値の数が一致しません: 2 と 1' 'package main; const a, b = 1; func main() int { return a }'
+assert_error '代入できません' 'package main; const c = 1; func main() int { c = 2; return c }'
+assert_error 'アドレスを取得できません' 'package main; const c = 1; func main() int { p := &c; return *p }'
+assert_error 'string型の値をint型として使えません' 'package main; const c int = "a"; func main() int { return c }'
+
+assert 4 'package main; func main() int { return 1 << 70 >> 68 }'
+assert 8 'package main; const big = 1 << 80; func main() int { return big >> 77 }'
+assert 3 'package main; func main() int { x := 1 << 40; return x >> 38 - 1 }'
+assert 248 'package main; func main() int { return -1 << 63 >> 60 }'
+assert 98 "package main; func main() int { var r rune = 1 + 'a'; return int(r) }"
+assert 5 'package main; func main() int { var b byte = 3; b += 2; return int(b) }'
+assert 254 'package main; func main() int { return int(^byte(1)) }'
+assert 2 'package main; const ( a = iota; b; c ); func main() int { return c }'
+assert 8 'package main; const ( _ = iota; KB = 1 << (10 * iota); MB ); func main() int { return MB >> 17 }'
+assert 5 'package main; func main() int { const c = 5; var b byte = c; return int(b) }'
+IOTAFN='package main
+type Weekday int
+const (
+	Sunday Weekday = iota
+	Monday
+	Tuesday
+)
+const (
+	a, b = iota, iota * 10
+	c, d
+	_, _
+	e, f
+)
+func main() int {
+	const (
+		x = 1 << iota
+		y
+		z
+	)
+	var w Weekday = Tuesday
+	return int(w) + a + b + c + d + e + f + x + y + z
+}'
+assert 53 "$IOTAFN"
+assert 53 "$IOTAFN" -abi internal
+assert_error '定数275はbyte型で表せません' 'package main; func main() int { var b byte = 25*11; return int(b) }'
+assert_error '定数275はbyte型で表せません' 'package main; func main() int { return int(byte(25*11)) }'
+assert_error '定数260はbyte型で表せません' 'package main; const c byte = 20*10; func main() int { return int(c + 60) }'
+assert_error '定数260はbyte型で表せません' 'package main; func main() int { return int(byte(25*10) + byte(10)) }'
+assert_error '定数1099511627776はrune型で表せません' 'package main; func main() int { const c rune = 1 << 40; return int(c) }'
+assert_error '定数9223372036854775808はint型で表せません' 'package main; func main() int { x := 1 << 63; return x }'
+assert_error '定数がオーバーフローしました' 'package main; const c = 1 << (25*21); func main() int { return 0 }'
+assert_error '0で除算しています' 'package main; func main() int { x := 3; return x % 0 }'
+assert_error 'シフト数が負です: -1' 'package main; func main() int { return 2 >> -1 }'
+assert_error '未定義の変数です: iota' 'package main; func main() int { return iota }'
+assert_error '定数の値がありません' 'package main; const ( a ); func main() int { return a }'
+assert_error '定数の値がありません' 'package main; const ( a = iota; b int ); func main() int { return b }'
+assert_error 'rune型の値をint型として使えません' "package main; func main() int { x := 'a'; return x }"
+assert 4 'package main; const N = 4; var a [N]int; func main() int { return len(a) }'
+assert 3 'package main; func main() int { var a [len("abc")]int; return len(a) }'
+assert 12 'package main; type T struct { a [N * 2]int; b bool }; const N = 3; func main() int { var t T; t.a[N*2-1] = 6; return t.a[5] + len(t.a) }'
+assert 12 'package main; type T struct { a [N * 2]int; b bool }; const N = 3; func main() int { var t T; t.a[N*2-1] = 6; return t.a[5] + len(t.a) }' -abi internal
+assert 7 'package main; type A [M]byte; const M = 2; func f() (A, int) { return A{3, 4}, 0 }; func main() int { const K = M + 1; var b [K]A; b[K-1], _ = f(); return int(b[2][0] + b[2][1]) }'
+assert 5 'package main; func main() int { var x [2][3]int; const n = len(x[0]) + len(x); return n }'
+assert_error '配列の長さが定数ではありません' 'package main; func main() int { n := 3; var a [n]int; return len(a) }'
+assert_error '配列の長さが定数ではありません' 'package main; var n = 3; func main() int { var a [n]int; return len(a) }'
+assert_error '配列の長さが負です: -1' 'package main; const N = -1; func main() int { var a [N]int; return len(a) }'
+assert_error '配列の長さが整数ではありません: string' 'package main; func main() int { var a ["a"]int; return len(a) }'
+
+assert 4 'package main; func main() int { return 1 << 100 >> 98 }'
+assert 89 'package main; func main() int { x := 123456789; return x % 100 }'
+assert 31 'package main; func main() int { return 0x1F }'
+assert 31 'package main; func main() int { return 0o17 + 017 + 0O1 }'
+assert 11 'package main; func main() int { return 0b1010 + 0B1 }'
+assert 100 'package main; func main() int { return 1_000_000 / 10_000 }'
+assert 255 'package main; func main() int { return 0x_FF_FF >> 8 }'
+assert 16 'package main; func main() int { var a [0x10]int; return len(a) }'
+assert 7 'package main; func main() int { x := 9223372036854775807; return x - 9223372036854775800 }'
+assert 86 'package main; func main() int { return 100000000000000000000 >> 60 }'
+assert_error '不正な整数リテラルです: 089' 'package main; func main() int { return 089 }'
+assert_error '不正な整数リテラルです: 1__0' 'package main; func main() int { return 1__0 }'
+assert_error '不正な整数リテラルです: 10_' 'package main; func main() int { return 10_ }'
+assert_error '不正な整数リテラルです: 0x' 'package main; func main() int { return 0x }'
+assert_error '不正な整数リテラルです: 0b102' 'package main; func main() int { return 0b102 }'
+assert_error '整数リテラルが大きすぎます: 0x100000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000' 'package main; func main() int { return 0x100000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000 }'
+assert_error '定数100000000000000000000はint型で表せません' 'package main; func main() int { x := 100000000000000000000; return x }'
+assert_error '定数256はbyte型で表せません' 'package main; func main() int { var b byte = 0x100; return int(b) }'
+assert_error '配列の長さが大きすぎます' 'package main; func main() int { var a [100000000000000000000]int; return 0 }'
 
 echo OK
@@ -2,32 +2,112 @@ package main
 
 import (
 	"fmt"
+	"math/big"
 	"strconv"
+	"strings"
 	"unicode"
+	"unicode/utf8"
 )
 
 type TokenKind int
 
 const (
-	TKReserved TokenKind = iota // 記号
-	TKReturn                    // return
-	TKIf                        // if
-	TKElse                      // else
-	TKFor                       // for
-	TKIdent                     // 識別子
-	TKNum                       // 整数
-	TKEOF                       // 終点
+	TKReserved    TokenKind = iota // 記号
+	TKReturn                       // return
+	TKIf                           // if
+	TKElse                         // else
+	TKFor                          // for
+	TKPackage                      // package
+	TKFunc                         // func
+	TKVar                          // var
+	TKBreak                        // break
+	TKContinue                     // continue
+	TKSwitch                       // switch
+	TKCase                         // case
+	TKDefault                      // default
+	TKFallthrough                  // fallthrough
+	TKType                         // type
+	TKStruct                       // struct
+	TKConst                        // const
+	TKIdent                        // 識別子
+	TKNum                          // 整数
+	TKStr                          // 文字列
+	TKRune                         // ルーン
+	TKEOF                          // 終点
 )
 
 var whatTokens = map[TokenKind]string{
-	TKReserved: "Reserved word",
-	TKReturn:   "return",
-	TKIf:       "if",
-	TKElse:     "else",
-	TKFor:      "for",
-	TKIdent:    "identifier",
-	TKNum:      "number",
-	TKEOF:      "End Of File",
+	TKReserved:    "Reserved word",
+	TKReturn:      "return",
+	TKIf:          "if",
+	TKElse:        "else",
+	TKFor:         "for",
+	TKPackage:     "package",
+	TKFunc:        "func",
+	TKVar:         "var",
+	TKBreak:       "break",
+	TKContinue:    "continue",
+	TKSwitch:      "switch",
+	TKCase:        "case",
+	TKDefault:     "default",
+	TKFallthrough: "fallthrough",
+	TKType:        "type",
+	TKStruct:      "struct",
+	TKConst:       "const",
+	TKIdent:       "identifier",
+	TKNum:         "number",
+	TKStr:         "string",
+	TKRune:        "rune",
+	TKEOF:         "End Of File",
+}
+
+// キーワードとトークンの種類の対応.
+var keywords = map[string]TokenKind{
+	"return":      TKReturn,
+	"if":          TKIf,
+	"else":        TKElse,
+	"for":         TKFor,
+	"package":     TKPackage,
+	"func":        TKFunc,
+	"var":         TKVar,
+	"break":       TKBreak,
+	"continue":    TKContinue,
+	"switch":      TKSwitch,
+	"case":        TKCase,
+	"default":     TKDefault,
+	"fallthrough": TKFallthrough,
+	"type":        TKType,
+	"struct":      TKStruct,
+	"const":       TKConst,
+}
+
+// 2文字以上の記号
+// 長いものから順に照合する.
+var punctuators = []string{
+	"...",
+	"<<=",
+	">>=",
+	"&^=",
+	"==",
+	"!=",
+	"<=",
+	">=",
+	":=",
+	"&&",
+	"||",
+	"<<",
+	">>",
+	"&^",
+	"+=",
+	"-=",
+	"*=",
+	"/=",
+	"%=",
+	"&=",
+	"|=",
+	"^=",
+	"++",
+	"--",
 }
 
 type Token struct {
@@ -35,14 +115,21 @@ type Token struct {
 	Next *Token
 	Val  int
 	Str  []rune
-	Loc  int
+	Pos
+
+	// 整数リテラルの値
+	Const *big.Int
+
+	// 文字列リテラルの内容
+	// エスケープシーケンスは解釈済み
+	Contents []byte
 }
 
-func NewToken(kind TokenKind, cur *Token, loc int, str ...rune) *Token {
+func NewToken(kind TokenKind, cur *Token, pos Pos, str ...rune) *Token {
 	tok := &Token{
 		Kind: kind,
 		Str:  str,
-		Loc:  loc,
+		Pos:  pos,
 	}
 
 	cur.Next = tok
@@ -83,10 +170,10 @@ func (tk *Token) ConsumeIdent() bool {
 func (tk *Token) Expect(kind TokenKind, op ...rune) error {
 	if !tk.Consume(kind, op...) {
 		if len(op) == 0 {
-			return userInput.Err(tk.Loc, fmt.Sprintf("'%s'ではありません", whatTokens[kind]))
+			return tk.Err(fmt.Sprintf("'%s'ではありません", whatTokens[kind]))
 		}
 
-		return userInput.Err(tk.Loc, fmt.Sprintf("'%s: %s'ではありません", whatTokens[kind], string(op)))
+		return tk.Err(fmt.Sprintf("'%s: %s'ではありません", whatTokens[kind], string(op)))
 	}
 
 	return nil
@@ -96,7 +183,7 @@ func (tk *Token) Expect(kind TokenKind, op ...rune) error {
 // それ以外の場合にはエラーを報告する.
 func (tk *Token) ExpectNum() (int, error) {
 	if tk.Kind != TKNum {
-		return 0, userInput.Err(tk.Loc, "数ではありません")
+		return 0, tk.Err("数ではありません")
 	}
 
 	val := tk.Val
@@ -117,51 +204,80 @@ func (tk *Token) Skip() *Token {
 	return tk.Next
 }
 
-func tokenize(p string) (*Token, error) {
+// 全てのソースファイルをトークナイズし、1つのトークン列として返す.
+func tokenize(inputs []*UserInput) (*Token, error) {
 	head := &Token{}
 	cur := head
 
-	for i := 0; i < len(p); i++ {
-		if unicode.IsSpace(rune(p[i])) {
-			continue
+	var last *UserInput
+
+	for _, input := range inputs {
+		var err error
+		if cur, err = tokenizeFile(input, cur); err != nil {
+			return nil, err
 		}
 
-		if tar := p[i:]; startsWith(tar, "==") || startsWith(tar, "!=") || startsWith(tar, "<=") || startsWith(tar, ">=") {
-			cur = NewToken(TKReserved, cur, i, []rune(tar[:2])...)
+		last = input
+	}
 
-			i++
+	NewToken(TKEOF, cur, last.Pos(len(last.Src)))
 
-			continue
-		}
+	return head.Next, nil
+}
+
+// ソースファイル1つ分をトークナイズし、curの後ろに繋げる
+// 最後のトークンを返す.
+func tokenizeFile(input *UserInput, cur *Token) (*Token, error) {
+	p := input.Src
 
-		if tar := p[i:]; startsWith(tar, "if") {
-			cur = NewToken(TKIf, cur, i, []rune(tar[:2])...)
+	// このファイルの最初のトークンの1つ前
+	start := cur
 
-			i++
+	for i := 0; i < len(p); i++ {
+		// 改行の手前で文が終わっていればセミコロンを補う
+		if p[i] == '\n' {
+			if cur != start && needsSemicolon(cur) {
+				cur = NewToken(TKReserved, cur, input.Pos(i), ';')
+			}
 
 			continue
 		}
 
-		if tar := p[i:]; startsWith(tar, "else") {
-			cur = NewToken(TKElse, cur, i, []rune(tar[:4])...)
+		if unicode.IsSpace(rune(p[i])) {
+			continue
+		}
 
-			i += 3
+		// 行コメントは改行の手前まで読み飛ばす
+		if startsWith(p[i:], "//") {
+			for i+1 < len(p) && p[i+1] != '\n' {
+				i++
+			}
 
 			continue
 		}
 
-		if tar := p[i:]; startsWith(tar, "for") {
-			cur = NewToken(TKFor, cur, i, []rune(tar[:3])...)
+		// 改行を含むブロックコメントは改行として扱う
+		if startsWith(p[i:], "/*") {
+			end := strings.Index(p[i+2:], "*/")
+			if end < 0 {
+				return nil, input.Err(i, "コメントが閉じられていません")
+			}
+
+			comment := p[i : i+2+end+2]
 
-			i += 2
+			if strings.Contains(comment, "\n") && cur != start && needsSemicolon(cur) {
+				cur = NewToken(TKReserved, cur, input.Pos(i), ';')
+			}
+
+			i += len(comment) - 1
 
 			continue
 		}
 
-		if tar := p[i:]; startsWith(tar, "return") && !isAlphaOrInt(rune(p[i+6])) {
-			cur = NewToken(TKReturn, cur, i, []rune(tar[:6])...)
+		if punct := readPunctuator(p[i:]); punct != "" {
+			cur = NewToken(TKReserved, cur, input.Pos(i), []rune(punct)...)
 
-			i += 5
+			i += len(punct) - 1
 
 			continue
 		}
@@ -181,73 +297,287 @@ func tokenize(p string) (*Token, error) {
 			'{',
 			'}',
 			',',
-			'&':
-			cur = NewToken(TKReserved, cur, i, []rune{rune(p[i])}...)
+			':',
+			'&',
+			'%',
+			'|',
+			'^',
+			'!',
+			'[',
+			']',
+			'.':
+			cur = NewToken(TKReserved, cur, input.Pos(i), []rune{rune(p[i])}...)
+
+			continue
+		}
+
+		if p[i] == '"' || p[i] == '`' {
+			n, contents, err := readString(input, i)
+			if err != nil {
+				return nil, err
+			}
+
+			cur = NewToken(TKStr, cur, input.Pos(i), []rune(p[i:i+n])...)
+			cur.Contents = contents
+
+			i += n - 1
 
 			continue
 		}
 
-		if isAlpha(rune(p[i])) {
+		if p[i] == '\'' {
+			n, c, err := readRune(input, i)
+			if err != nil {
+				return nil, err
+			}
+
+			cur = NewToken(TKRune, cur, input.Pos(i), []rune(p[i:i+n])...)
+			cur.Val = int(c)
+
+			i += n - 1
+
+			continue
+		}
+
+		if isAlpha(rune(p[i])) || p[i] == '_' {
 			str := strToAlpha(p[i:])
-			cur = NewToken(TKIdent, cur, i, []rune(str)...)
+
+			kind, ok := keywords[str]
+			if !ok {
+				kind = TKIdent
+			}
+
+			cur = NewToken(kind, cur, input.Pos(i), []rune(str)...)
 
 			i += len(str) - 1
 
 			continue
 		}
 
-		if unicode.IsDigit(rune(p[i])) {
-			n, err := strToInt(p[i:])
+		if isInt(rune(p[i])) {
+			lit := strToAlpha(p[i:])
+
+			v, err := intLiteral(lit)
 			if err != nil {
-				return nil, userInput.Err(i, "数ではありません")
+				return nil, input.Err(i, err.Error())
 			}
 
-			d := calcNumOfIntDigit(n)
-
-			cur = NewToken(TKNum, cur, i, []rune(p[i:i+d-1])...)
-			cur.Val = n
+			cur = NewToken(TKNum, cur, input.Pos(i), []rune(lit)...)
+			cur.Val = int(v.Int64())
+			cur.Const = v
 
-			i += d - 1
+			i += len(lit) - 1
 
 			continue
 		}
 
-		return nil, userInput.Err(i, "トークナイズできません")
+		return nil, input.Err(i, "トークナイズできません")
 	}
 
-	NewToken(TKEOF, cur, len(p))
+	// ファイルの終わりも改行と同じように扱う
+	if cur != start && needsSemicolon(cur) {
+		cur = NewToken(TKReserved, cur, input.Pos(len(p)), ';')
+	}
 
-	return head.Next, nil
+	return cur, nil
 }
 
-// 文字列を整数値まで読み進めるだけ読み進める.
-func strToInt(s string) (int, error) {
-	var (
-		n      int
-		digits int = 1
-		read   bool
-	)
+// 行末のトークンの後ろにセミコロンを補う必要があれば真を返す.
+func needsSemicolon(tk *Token) bool {
+	switch tk.Kind {
+	case TKIdent, TKNum, TKStr, TKRune, TKReturn, TKBreak, TKContinue, TKFallthrough:
+		return true
+	case TKReserved:
+		return tk.Consume(TKReserved, ')') || tk.Consume(TKReserved, '}') || tk.Consume(TKReserved, ']') ||
+			tk.Consume(TKReserved, []rune("++")...) || tk.Consume(TKReserved, []rune("--")...)
+	}
 
-	for _, c := range s {
-		if !isInt(c) {
-			break
+	return false
+}
+
+// p[i]から始まる文字列リテラルを読む
+// リテラルの長さと、エスケープシーケンスを解釈した内容を返す.
+func readString(input *UserInput, i int) (int, []byte, error) {
+	p := input.Src
+
+	// 生の文字列リテラルはキャリッジリターンを除いてそのまま使う
+	if p[i] == '`' {
+		end := strings.IndexByte(p[i+1:], '`')
+		if end < 0 {
+			return 0, nil, input.Err(i, "文字列が閉じられていません")
 		}
 
-		n = n*digits + int(c-'0')
-		digits *= 10
-		read = true
+		contents := strings.ReplaceAll(p[i+1:i+1+end], "\r", "")
+
+		return end + 2, []byte(contents), nil
 	}
 
-	if !read {
-		return 0, ErrNoInt
+	contents := []byte{}
+
+	for j := i + 1; ; {
+		if j >= len(p) || p[j] == '\n' {
+			return 0, nil, input.Err(i, "文字列が閉じられていません")
+		}
+
+		switch p[j] {
+		case '"':
+			return j + 1 - i, contents, nil
+		case '\\':
+			c, isByte, n := readEscape(p[j:], '"')
+			if n == 0 {
+				return 0, nil, input.Err(j, "不正なエスケープシーケンスです")
+			}
+
+			if isByte {
+				contents = append(contents, byte(c))
+			} else {
+				contents = append(contents, string(c)...)
+			}
+
+			j += n
+		default:
+			contents = append(contents, p[j])
+			j++
+		}
 	}
+}
+
+// p[i]から始まるルーンリテラルを読む
+// リテラルの長さと、その表すコードポイントを返す.
+func readRune(input *UserInput, i int) (int, rune, error) {
+	p := input.Src
+	j := i + 1
 
-	return n, nil
+	if j >= len(p) || p[j] == '\n' {
+		return 0, 0, input.Err(i, "ルーンリテラルが閉じられていません")
+	}
+
+	if p[j] == '\'' {
+		return 0, 0, input.Err(i, "空のルーンリテラルです")
+	}
+
+	var c rune
+
+	if p[j] == '\\' {
+		v, _, n := readEscape(p[j:], '\'')
+		if n == 0 {
+			return 0, 0, input.Err(j, "不正なエスケープシーケンスです")
+		}
+
+		c = v
+		j += n
+	} else {
+		v, n := utf8.DecodeRuneInString(p[j:])
+		c = v
+		j += n
+	}
+
+	if j >= len(p) || p[j] != '\'' {
+		return 0, 0, input.Err(i, "ルーンリテラルが閉じられていません")
+	}
+
+	return j + 1 - i, c, nil
 }
 
-// 整数値の桁数を調べる.
-func calcNumOfIntDigit(n int) int {
-	return len(strconv.Itoa(n))
+// sの先頭にあるエスケープシーケンスを読む
+// quoteはリテラルを囲む引用符で、その文字だけをエスケープできる
+// 値と、それが1バイトの値を表すか、読んだ長さを返す
+// 不正なエスケープシーケンスであれば長さに0を返す.
+func readEscape(s string, quote byte) (rune, bool, int) {
+	if len(s) < 2 {
+		return 0, false, 0
+	}
+
+	switch s[1] {
+	case 'a':
+		return '\a', false, 2
+	case 'b':
+		return '\b', false, 2
+	case 'f':
+		return '\f', false, 2
+	case 'n':
+		return '\n', false, 2
+	case 'r':
+		return '\r', false, 2
+	case 't':
+		return '\t', false, 2
+	case 'v':
+		return '\v', false, 2
+	case '\\':
+		return '\\', false, 2
+	case quote:
+		return rune(quote), false, 2
+	case '0', '1', '2', '3', '4', '5', '6', '7':
+		c, ok := readDigits(s[1:], 3, 8)
+		if !ok || c > 255 {
+			return 0, false, 0
+		}
+
+		return c, true, 4
+	case 'x':
+		c, ok := readDigits(s[2:], 2, 16)
+		if !ok {
+			return 0, false, 0
+		}
+
+		return c, true, 4
+	case 'u', 'U':
+		n := 4
+		if s[1] == 'U' {
+			n = 8
+		}
+
+		c, ok := readDigits(s[2:], n, 16)
+		if !ok || !utf8.ValidRune(c) {
+			return 0, false, 0
+		}
+
+		return c, false, n + 2
+	}
+
+	return 0, false, 0
+}
+
+// sの先頭にあるn桁のbase進数を読む.
+func readDigits(s string, n int, base int) (rune, bool) {
+	if len(s) < n {
+		return 0, false
+	}
+
+	c, err := strconv.ParseUint(s[:n], base, 32)
+	if err != nil {
+		return 0, false
+	}
+
+	return rune(c), true
+}
+
+// 文字列の先頭にある2文字以上の記号を返す
+// 該当するものがなければ空文字列を返す.
+func readPunctuator(s string) string {
+	for _, punct := range punctuators {
+		if startsWith(s, punct) {
+			return punct
+		}
+	}
+
+	return ""
+}
+
+// 整数リテラルの値を求める
+// 0x, 0o, 0bで始まれば16進数、8進数、2進数、0で始まれば8進数とする
+// 数字の間と基数の接頭辞の直後には_を置ける.
+func intLiteral(lit string) (*big.Int, error) {
+	v, ok := new(big.Int).SetString(lit, 0)
+	if !ok {
+		return nil, fmt.Errorf("不正な整数リテラルです: %s", lit)
+	}
+
+	if v.BitLen() > maxConstBits {
+		return nil, fmt.Errorf("整数リテラルが大きすぎます: %s", lit)
+	}
+
+	return v, nil
 }
 
 // 文字列が対象で始まるか調べる.
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+type TypeKind int
+
+const (
+	TYVoid        TypeKind = iota // 値なし
+	TYInt                         // int
+	TYBool                        // bool
+	TYPtr                         // ポインタ
+	TYTuple                       // 関数の複数の戻り値
+	TYString                      // string
+	TYByte                        // byte
+	TYRune                        // rune
+	TYArray                       // 配列
+	TYSlice                       // スライス
+	TYStruct                      // 構造体
+	TYUntypedInt                  // 型のない整数定数
+	TYUntypedRune                 // 型のない文字定数
+	TYNil                         // 型のないnil
+)
+
+type Type struct {
+	Kind   TypeKind
+	Base   *Type    // ポインタの指す先の型、配列やスライスの要素の型
+	Fields []*Field // 構造体のフィールド、複数の戻り値の各要素
+	Len    int      // 配列の長さ
+	Size   int
+	Align  int
+	Name   string
+
+	// 配列の長さを表す式
+	// 長さを型検査で求める配列型でなければnil
+	LenExpr *Node
+
+	// 型検査で長さを求める配列型を含み、大きさが決まっていなければ真
+	Pending bool
+}
+
+// 複数の値をまとめた型の要素
+// 複数の戻り値の要素には名前がない.
+type Field struct {
+	Name   []rune
+	Type   *Type
+	Offset int
+}
+
+var (
+	typeVoid   = &Type{Kind: TYVoid, Name: "void"}
+	typeInt    = &Type{Kind: TYInt, Size: 8, Align: 8, Name: "int"}
+	typeBool   = &Type{Kind: TYBool, Size: 1, Align: 1, Name: "bool"}
+	typeByte   = &Type{Kind: TYByte, Size: 1, Align: 1, Name: "byte"}
+	typeRune   = &Type{Kind: TYRune, Size: 4, Align: 4, Name: "rune"}
+	typeString = &Type{Kind: TYString, Size: 16, Align: 8, Name: "string"}
+
+	typeUntypedInt  = &Type{Kind: TYUntypedInt, Size: 8, Align: 8, Name: "untyped int"}
+	typeUntypedRune = &Type{Kind: TYUntypedRune, Size: 8, Align: 8, Name: "untyped rune"}
+	typeNil         = &Type{Kind: TYNil, Size: 8, Align: 8, Name: "untyped nil"}
+)
+
+// 事前宣言された型名.
+var predeclaredTypes = map[string]*Type{
+	"int":    typeInt,
+	"bool":   typeBool,
+	"string": typeString,
+	"byte":   typeByte,
+	"uint8":  typeByte,
+	"rune":   typeRune,
+	"int32":  typeRune,
+}
+
+func NewPointerType(base *Type) *Type {
+	return &Type{
+		Kind:  TYPtr,
+		Base:  base,
+		Size:  8,
+		Align: 8,
+	}
+}
+
+func NewArrayType(base *Type, n int) *Type {
+	ty := &Type{Kind: TYArray, Base: base, Len: n}
+	ty.layout()
+
+	return ty
+}
+
+// 長さを式で書いた配列型
+// 長さと大きさは型検査で決める.
+func NewArrayTypeOf(base *Type, n *Node) *Type {
+	ty := &Type{Kind: TYArray, Base: base, LenExpr: n}
+	ty.layout()
+
+	return ty
+}
+
+// スライスは先頭要素のアドレス、長さ、容量の3語で表す.
+func NewSliceType(base *Type) *Type {
+	return &Type{
+		Kind:  TYSlice,
+		Base:  base,
+		Size:  24,
+		Align: 8,
+	}
+}
+
+// 構造体型
+// 各フィールドはその型の境界に揃えて並べ、
+// 全体の大きさはフィールドの最も大きい境界の倍数にする.
+func NewStructType(fields []*Field) *Type {
+	ty := &Type{Kind: TYStruct, Fields: fields}
+	ty.layout()
+
+	return ty
+}
+
+// 関数の複数の戻り値の型
+// 各要素は先頭から順に、語の境界に揃えてメモリ上に並べる.
+func NewTupleType(types []*Type) *Type {
+	ty := &Type{Kind: TYTuple}
+
+	for _, t := range types {
+		ty.Fields = append(ty.Fields, &Field{Type: t})
+	}
+
+	ty.layout()
+
+	return ty
+}
+
+// 要素の型から、型の大きさと境界、フィールドの位置を決める
+// 大きさの決まっていない型を含めば、型検査で決め直すまで保留する.
+func (ty *Type) layout() {
+	switch ty.Kind {
+	case TYArray:
+		ty.Size = ty.Base.Size * ty.Len
+		ty.Align = ty.Base.Align
+		ty.Pending = ty.LenExpr != nil || ty.Base.Pending
+	case TYStruct:
+		ty.Size, ty.Align, ty.Pending = 0, 1, false
+
+		for _, f := range ty.Fields {
+			f.Offset = alignTo(ty.Size, f.Type.Align)
+			ty.Size = f.Offset + f.Type.Size
+
+			if f.Type.Align > ty.Align {
+				ty.Align = f.Type.Align
+			}
+
+			ty.Pending = ty.Pending || f.Type.Pending
+		}
+
+		ty.Size = alignTo(ty.Size, ty.Align)
+	case TYTuple:
+		ty.Size, ty.Align, ty.Pending = 0, 8, false
+
+		for _, f := range ty.Fields {
+			f.Offset = ty.Size
+			ty.Size += alignTo(f.Type.Size, 8)
+			ty.Pending = ty.Pending || f.Type.Pending
+		}
+	}
+
+	if ty.Pending {
+		pendingTypes = append(pendingTypes, ty)
+	}
+}
+
+func (ty *Type) String() string {
+	// 宣言された型は名前で表す
+	if ty.Name != "" {
+		return ty.Name
+	}
+
+	switch ty.Kind {
+	case TYPtr:
+		return fmt.Sprintf("*%s", ty.Base)
+	case TYArray:
+		return fmt.Sprintf("[%d]%s", ty.Len, ty.Base)
+	case TYSlice:
+		return fmt.Sprintf("[]%s", ty.Base)
+	case TYTuple:
+		elems := make([]string, len(ty.Fields))
+		for i, f := range ty.Fields {
+			elems[i] = f.Type.String()
+		}
+
+		return fmt.Sprintf("(%s)", strings.Join(elems, ", "))
+	case TYStruct:
+		if len(ty.Fields) == 0 {
+			return "struct {}"
+		}
+
+		fields := make([]string, len(ty.Fields))
+		for i, f := range ty.Fields {
+			fields[i] = fmt.Sprintf("%s %s", string(f.Name), f.Type)
+		}
+
+		return fmt.Sprintf("struct { %s }", strings.Join(fields, "; "))
+	}
+
+	return ty.Name
+}
+
+func (ty *Type) IsInteger() bool {
+	switch ty.Kind {
+	case TYInt, TYByte, TYRune, TYUntypedInt, TYUntypedRune:
+		return true
+	}
+
+	return false
+}
+
+// 型のない定数の型であれば真を返す.
+func (ty *Type) IsUntyped() bool {
+	return ty.Kind == TYUntypedInt || ty.Kind == TYUntypedRune
+}
+
+// 型のない定数を、文脈から型が決まらないときに使う型
+// 型のある値の型はそのまま返す.
+func defaultType(ty *Type) *Type {
+	switch {
+	case ty == nil:
+		return nil
+	case ty.Kind == TYUntypedInt:
+		return typeInt
+	case ty.Kind == TYUntypedRune:
+		return typeRune
+	}
+
+	return ty
+}
+
+// 複数の語からなり、値ではなくアドレスで扱う型であれば真を返す.
+func (ty *Type) IsAggregate() bool {
+	switch ty.Kind {
+	case TYTuple, TYString, TYArray, TYSlice, TYStruct:
+		return true
+	}
+
+	return false
+}
+
+// 引数や戻り値として受け渡すときの語数
+// 端数のバイトも1語として数える.
+func (ty *Type) Words() int {
+	if ty.IsAggregate() {
+		return (ty.Size + 7) / 8
+	}
+
+	return 1
+}
+
+func (ty *Type) IsPointer() bool {
+	return ty.Kind == TYPtr
+}
+
+// nilを代入したり、nilと比較したりできる型であれば真を返す.
+func (ty *Type) IsNilable() bool {
+	return ty.Kind == TYPtr || ty.Kind == TYSlice
+}
+
+// 構造体のフィールドを名前で探す.
+func (ty *Type) FindField(name []rune) *Field {
+	for _, f := range ty.Fields {
+		if string(f.Name) == string(name) {
+			return f
+		}
+	}
+
+	return nil
+}
+
+// 2つの型が同一か調べる
+// 宣言された型は、同じ宣言によるものだけが同一になる.
+func identical(a *Type, b *Type) bool {
+	if a.Name != "" || b.Name != "" {
+		return a == b
+	}
+
+	if a.Kind == TYPtr && b.Kind == TYPtr {
+		return identical(a.Base, b.Base)
+	}
+
+	if a.Kind == TYArray && b.Kind == TYArray {
+		return a.Len == b.Len && identical(a.Base, b.Base)
+	}
+
+	if a.Kind == TYSlice && b.Kind == TYSlice {
+		return identical(a.Base, b.Base)
+	}
+
+	if (a.Kind == TYTuple && b.Kind == TYTuple) || (a.Kind == TYStruct && b.Kind == TYStruct) {
+		if len(a.Fields) != len(b.Fields) {
+			return false
+		}
+
+		for i := range a.Fields {
+			if string(a.Fields[i].Name) != string(b.Fields[i].Name) || !identical(a.Fields[i].Type, b.Fields[i].Type) {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	return a == b
+}